@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Account statuses. Accounts not in the registry are active.
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// checkAccountActive returns an error unless the account is active
+func (c *ExchangeChaincode) checkAccountActive(owner string) error {
+	info, err := c.getAccountInfo(owner)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving account [%s]: [%s]", owner, err)
+	}
+	if info.Status != AccountActive {
+		return newError(CodeAccountUnavailable, "The account [%s] is %s", owner, info.Status).
+			With("account", owner).With("status", info.Status)
+	}
+	return nil
+}
+
+// setAccountStatus change the status of an account, a closed account stays closed
+// args: account, status, reason
+func (c *ExchangeChaincode) setAccountStatus() pb.Response {
+	myLogger.Debug("Set Account Status...")
+
+	owner := c.args[0]
+	status := c.args[1]
+	reason := c.args[2]
+
+	if status != AccountActive && status != AccountFrozen && status != AccountClosed {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid account status [%s]", status).With("status", status))
+	}
+
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	info, err := c.getAccountInfo(owner)
+	if err != nil {
+		myLogger.Errorf("setAccountStatus error1:%s", err)
+		return errorResponse(err)
+	}
+	if info.Status == AccountClosed {
+		return errorResponse(newError(CodeAccountUnavailable, "The account [%s] is closed", owner).
+			With("account", owner).With("status", info.Status))
+	}
+	if info.Status == status {
+		return errorResponse(newError(CodeInvalidArgument, "The account [%s] is already %s", owner, status).
+			With("account", owner).With("status", status))
+	}
+
+	log := &AccountStatusLog{
+		Owner:      owner,
+		From:       info.Status,
+		To:         status,
+		Reason:     reason,
+		Operator:   caller,
+		ChangeTime: c.now,
+	}
+
+	info.Status = status
+	info.Reason = reason
+	info.Operator = caller
+	err = c.putAccountInfo(info)
+	if err != nil {
+		myLogger.Errorf("setAccountStatus error2:%s", err)
+		return errorResponse(err)
+	}
+
+	err = c.putAccountStatusLog(log)
+	if err != nil {
+		myLogger.Errorf("setAccountStatus error3:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(log)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_accountStatus", payload)
+
+	myLogger.Debug("Set Account Status...done")
+	return shim.Success(payload)
+}
+
+// queryAccountStatus returns the status of an account with a page of its status changes
+// args: [account] (auditor only), [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryAccountStatus() pb.Response {
+	myLogger.Debug("queryAccountStatus...")
+
+	owner, err := c.getAuditAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	info, err := c.getAccountInfo(owner)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var logs []*AccountStatusLog
+	next, err := c.getPage(keyRange{"AccountStatusLog~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &logs)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&struct {
+		*AccountInfo
+		Logs     []*AccountStatusLog `json:"logs"`
+		Bookmark string              `json:"bookmark,omitempty"`
+	}{info, logs, next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestClosedAccountStaysClosed(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.acct("alice")
+
+	e.mustFail(CodeInvalidArgument, "admin", "setAccountStatus", alice, AccountActive, "test")
+	e.mustInvoke("admin", "setAccountStatus", alice, AccountFrozen, "test")
+	e.mustFail(CodeInvalidArgument, "admin", "setAccountStatus", alice, AccountFrozen, "test")
+	e.mustInvoke("admin", "setAccountStatus", alice, AccountClosed, "test")
+
+	e.mustFail(CodeAccountUnavailable, "admin", "setAccountStatus", alice, AccountActive, "test")
+	e.mustFail(CodeAccountUnavailable, "admin", "setAccountStatus", alice, AccountFrozen, "test")
+}
+
+func TestFrozenAccountCantTrade(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.mustInvoke("admin", "setAccountStatus", e.acct("alice"), AccountFrozen, "sanctions")
+
+	e.mustFail(CodeAccountUnavailable, "alice", "placeOrder", `{"srcCurrency":"BTC","srcCount":10,"desCurrency":"ETH","desCount":20}`)
+	e.mustFail(CodeAccountUnavailable, "alice", "redeem", "BTC", "1")
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A1","count":10,"desCurrency":"ETH","desCount":20}]`, "true", "test")
+	var batch BatchResult
+	e.event("chaincode_lock", &batch)
+	checkBatch(t, batch, 0, CodeAccountUnavailable)
+
+	e.mustInvoke("admin", "setAccountStatus", e.acct("alice"), AccountActive, "cleared")
+	e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	e.checkBalance("alice", "BTC", 90, 10)
+}
+
+func TestAuditorReadsTheStatusOfOtherAccounts(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "setAccountStatus", e.acct("alice"), AccountFrozen, "test")
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+
+	e.mustFail(CodeUnauthorized, "op", "queryAccountStatus", e.acct("alice"))
+	e.mustFail(CodeUnauthorized, "bob", "queryAccountStatus", e.acct("alice"))
+	e.mustInvoke("alice", "queryAccountStatus")
+	e.mustInvoke("aud", "queryAccountStatus", e.acct("alice"))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// SupplyAudit reconciles the assets of a currency with its Currency record.
+// Expected is Count - LeftCount, Discrepancy is Holdings + Locked - Expected.
+type SupplyAudit struct {
+	Currency    string `json:"currency"`
+	Count       int64  `json:"count"`
+	LeftCount   int64  `json:"leftCount"`
+	Expected    int64  `json:"expected"`
+	Holdings    int64  `json:"holdings"`
+	Locked      int64  `json:"locked"`
+	Accounts    int64  `json:"accounts"`
+	Negative    int64  `json:"negative"`
+	Discrepancy int64  `json:"discrepancy"`
+}
+
+// SupplyReport is the result of auditSupply, Balanced is set when no currency has a discrepancy
+type SupplyReport struct {
+	Time       int64          `json:"time"`
+	Balanced   bool           `json:"balanced"`
+	Currencies []*SupplyAudit `json:"currencies"`
+}
+
+// auditSupply sums the assets of every currency, or of one, and compares them with
+// the supply recorded in the Currency. Assets of unknown currencies are reported too.
+// args: [currency]
+func (c *ExchangeChaincode) auditSupply() pb.Response {
+	myLogger.Debug("auditSupply...")
+
+	name := ""
+	if len(c.args) > 0 {
+		name = c.args[0]
+	}
+
+	audits := map[string]*SupplyAudit{}
+	if name != "" {
+		curr, err := c.getCurrencyByName(name)
+		if err != nil {
+			myLogger.Errorf("auditSupply error1:%s", err)
+			return errorResponse(err)
+		}
+		if curr == nil {
+			return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", name).With("currency", name))
+		}
+		audits[curr.Name] = &SupplyAudit{Currency: curr.Name, Count: curr.Count, LeftCount: curr.LeftCount}
+	} else {
+		currs, err := c.getAllCurrency()
+		if err != nil {
+			myLogger.Errorf("auditSupply error2:%s", err)
+			return errorResponse(err)
+		}
+		for _, curr := range currs {
+			audits[curr.Name] = &SupplyAudit{Currency: curr.Name, Count: curr.Count, LeftCount: curr.LeftCount}
+		}
+	}
+
+	// the assets of one currency are a single range of the currency-first index
+	assets := keyRange{"Asset~currency~owner~uuid", nil}
+	if name != "" {
+		assets.attrs = []string{name}
+	}
+	err := c.scanKeys([]keyRange{assets}, "", func(key string) (bool, error) {
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return false, err
+		}
+
+		asset, err := c.getAsset(parts[2])
+		if err != nil {
+			return false, err
+		}
+		if asset == nil {
+			return true, nil
+		}
+
+		audit, ok := audits[asset.Currency]
+		if !ok {
+			audit = &SupplyAudit{Currency: asset.Currency}
+			audits[asset.Currency] = audit
+		}
+		audit.Holdings += asset.Count
+		audit.Locked += asset.LockCount
+		audit.Accounts++
+		if asset.Count < 0 || asset.LockCount < 0 {
+			audit.Negative++
+		}
+		return true, nil
+	})
+	if err != nil {
+		myLogger.Errorf("auditSupply error3:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving assets: [%s]", err))
+	}
+
+	var names []string
+	for currency := range audits {
+		names = append(names, currency)
+	}
+	sort.Strings(names)
+
+	report := &SupplyReport{Time: c.now, Balanced: true, Currencies: []*SupplyAudit{}}
+	for _, currency := range names {
+		audit := audits[currency]
+		audit.Expected = audit.Count - audit.LeftCount
+		audit.Discrepancy = audit.Holdings + audit.Locked - audit.Expected
+		if audit.Discrepancy != 0 || audit.Negative != 0 {
+			myLogger.Errorf("auditSupply currency [%s] is off by [%d], [%d] negative balances", currency, audit.Discrepancy, audit.Negative)
+			report.Balanced = false
+		}
+		report.Currencies = append(report.Currencies, audit)
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("auditSupply...done")
+	return shim.Success(payload)
+}
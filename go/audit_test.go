@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestAuditSupplyBalancesAfterTrading(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+	e.mustInvoke("admin", "setFeeCollector", e.acct("fees"))
+	e.mustInvoke("admin", "setFeeSchedule", `{"srcCurrency":"BTC","desCurrency":"ETH","makerBps":10,"takerBps":100}`)
+	e.assign("BTC", "alice", 1000)
+	e.assign("ETH", "bob", 3000)
+
+	e.placeOrder("alice", "BTC", 1000, "ETH", 2000)
+	e.now++
+	e.placeOrder("bob", "ETH", 3000, "BTC", 1000)
+	if fills := len(e.match().Fills); fills != 1 {
+		t.Fatalf("match made %d fills", fills)
+	}
+
+	report := new(SupplyReport)
+	mustUnmarshal(t, e.mustInvoke("aud", "auditSupply"), report)
+	if !report.Balanced {
+		t.Fatalf("The supply is not balanced: %+v", report)
+	}
+	for _, audit := range report.Currencies {
+		if audit.Discrepancy != 0 || audit.Negative != 0 || audit.Holdings+audit.Locked != audit.Expected {
+			t.Fatalf("The audit of %s is %+v", audit.Currency, audit)
+		}
+	}
+}
+
+func TestAuditSupplyOfOneCurrency(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+	e.assign("BTC", "alice", 10)
+	e.assign("BTC", "bob", 20)
+	e.assign("ETH", "alice", 30)
+
+	report := new(SupplyReport)
+	mustUnmarshal(t, e.mustInvoke("aud", "auditSupply", "BTC"), report)
+	if !report.Balanced || len(report.Currencies) != 1 {
+		t.Fatalf("The report is %+v", report)
+	}
+	if audit := report.Currencies[0]; audit.Currency != "BTC" || audit.Accounts != 2 || audit.Holdings != 30 {
+		t.Fatalf("The audit of BTC is %+v", audit)
+	}
+
+	e.mustFail(CodeCurrencyNotFound, "aud", "auditSupply", "LTC")
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// testClock returns the time of the test env
+type testClock struct{ now *int64 }
+
+func (tc testClock) Now(stub shim.ChaincodeStubInterface) (int64, error) { return *tc.now, nil }
+
+// testStub runs one transaction on the shared MockStub. Like a peer, it only
+// shows the writes to other transactions once the transaction succeeded.
+type testStub struct {
+	*shim.MockStub
+	env     *testEnv
+	creator []byte
+	fn      string
+	args    []string
+	events  map[string][]byte
+	pending map[string][]byte
+	order   []string
+}
+
+func (s *testStub) GetCreator() ([]byte, error)                  { return s.creator, nil }
+func (s *testStub) GetFunctionAndParameters() (string, []string) { return s.fn, s.args }
+func (s *testStub) GetStringArgs() []string                      { return s.args }
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.events[name] = payload
+	return nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	if _, ok := s.pending[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.pending[key] = value
+	return nil
+}
+
+func (s *testStub) DelState(key string) error {
+	return s.PutState(key, nil)
+}
+
+// GetHistoryForKey returns the committed versions of a key, oldest first
+func (s *testStub) GetHistoryForKey(key string) (shim.StateQueryIteratorInterface, error) {
+	return &testIterator{kvs: s.env.history[key]}, nil
+}
+
+// GetStateByRange records the start of the range
+func (s *testStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	s.env.ranges = append(s.env.ranges, startKey)
+	return s.MockStub.GetStateByRange(startKey, endKey)
+}
+
+// GetQueryResult runs the order queries of queryOrders. It sorts on the time field
+// of the sort then the key, honours the cursor and limit of the query and ignores
+// the other fields of the selector.
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	s.env.queries = append(s.env.queries, query)
+
+	var q struct {
+		Selector struct {
+			And []map[string]json.RawMessage `json:"$and"`
+		} `json:"selector"`
+		Sort  []map[string]string `json:"sort"`
+		Limit int                 `json:"limit"`
+	}
+	err := json.Unmarshal([]byte(query), &q)
+	if err != nil {
+		return nil, err
+	}
+	timeField := ""
+	for field := range q.Sort[len(q.Sort)-1] {
+		timeField = field
+	}
+
+	type doc struct {
+		time int64
+		key  string
+	}
+	timeOf := func(value []byte) int64 {
+		var fields map[string]json.RawMessage
+		json.Unmarshal(value, &fields)
+		var t int64
+		json.Unmarshal(fields[timeField], &t)
+		return t
+	}
+
+	var after *doc
+	for _, cond := range q.Selector.And {
+		var or []map[string]json.RawMessage
+		if json.Unmarshal(cond["$or"], &or) != nil {
+			continue
+		}
+		for _, c := range or {
+			if id, ok := c["_id"]; ok {
+				var gt struct {
+					Gt string `json:"$gt"`
+				}
+				json.Unmarshal(id, &gt)
+				after = &doc{key: gt.Gt}
+				json.Unmarshal(c[timeField], &after.time)
+			}
+		}
+	}
+
+	var docs []doc
+	for k, v := range s.MockStub.State {
+		if !strings.Contains(string(v), `"rawUUID"`) {
+			continue
+		}
+		d := doc{timeOf(v), k}
+		if after != nil && (d.time < after.time || (d.time == after.time && d.key <= after.key)) {
+			continue
+		}
+		docs = append(docs, d)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].time < docs[j].time || (docs[i].time == docs[j].time && docs[i].key < docs[j].key)
+	})
+	if q.Limit > 0 && len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+	}
+
+	var kvs []testKV
+	for _, d := range docs {
+		kvs = append(kvs, testKV{d.key, s.MockStub.State[d.key]})
+	}
+	return &testIterator{kvs: kvs}, nil
+}
+
+type testKV struct {
+	key   string
+	value []byte
+}
+
+type testIterator struct {
+	kvs []testKV
+	i   int
+}
+
+func (it *testIterator) HasNext() bool { return it.i < len(it.kvs) }
+
+func (it *testIterator) Next() (string, []byte, error) {
+	it.i++
+	return it.kvs[it.i-1].key, it.kvs[it.i-1].value, nil
+}
+
+func (it *testIterator) Close() error { return nil }
+
+// testEnv is a channel with one chaincode, deployed by "admin" with operator "op"
+// and issuer "iss", who created BTC and ETH with a supply of 1000000 each
+type testEnv struct {
+	t       *testing.T
+	cc      *ExchangeChaincode
+	ms      *shim.MockStub
+	now     int64
+	txs     int
+	ids     map[string][]byte
+	history map[string][]testKV
+	queries []string
+	ranges  []string
+	last    *testStub
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	e := &testEnv{t: t, now: 1500000000000, ids: map[string][]byte{}, history: map[string][]testKV{}}
+	e.cc = &ExchangeChaincode{clock: testClock{&e.now}}
+	e.ms = shim.NewMockStub("exchange", e.cc)
+
+	resp := e.call(true, "admin", "", e.acct("op"))
+	if resp.Status != shim.OK {
+		t.Fatalf("Init failed: %s", resp.Message)
+	}
+	e.mustInvoke("admin", "grantRole", e.acct("iss"), string(RoleIssuer))
+	e.mustInvoke("iss", "create", `{"name":"BTC","count":1000000}`)
+	e.mustInvoke("iss", "create", `{"name":"ETH","count":1000000}`)
+	return e
+}
+
+// serializedIdentity returns an Org1MSP identity with a self-signed certificate of the subject
+func serializedIdentity(t *testing.T, subject pkix.Name) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: subject, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org1MSP", IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// identity returns the serialized identity of a test user
+func (e *testEnv) identity(name string) []byte {
+	if id, ok := e.ids[name]; ok {
+		return id
+	}
+
+	id := serializedIdentity(e.t, pkix.Name{CommonName: name, Organization: []string{"org1"}})
+	e.ids[name] = id
+	return id
+}
+
+// acct returns the account ID of a test user
+func (e *testEnv) acct(name string) string {
+	account, err := accountID(e.identity(name))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return account
+}
+
+// call runs Init or Invoke as a transaction of the user and commits it when it succeeds
+func (e *testEnv) call(init bool, who, fn string, args ...string) pb.Response {
+	e.txs++
+	txID := fmt.Sprintf("tx%d", e.txs)
+	s := &testStub{MockStub: e.ms, env: e, creator: e.identity(who), fn: fn, args: args,
+		events: map[string][]byte{}, pending: map[string][]byte{}}
+	e.last = s
+
+	e.ms.MockTransactionStart(txID)
+	var resp pb.Response
+	if init {
+		resp = e.cc.Init(s)
+	} else {
+		resp = e.cc.Invoke(s)
+	}
+	if resp.Status == shim.OK {
+		for _, k := range s.order {
+			v := s.pending[k]
+			if v == nil {
+				e.ms.DelState(k)
+				continue
+			}
+			e.ms.PutState(k, v)
+			e.history[k] = append(e.history[k], testKV{txID, v})
+		}
+	}
+	e.ms.MockTransactionEnd(txID)
+	return resp
+}
+
+func (e *testEnv) invoke(who, fn string, args ...string) pb.Response {
+	return e.call(false, who, fn, args...)
+}
+
+// mustInvoke invokes a function and fails the test unless it succeeds
+func (e *testEnv) mustInvoke(who, fn string, args ...string) []byte {
+	e.t.Helper()
+	resp := e.invoke(who, fn, args...)
+	if resp.Status != shim.OK {
+		e.t.Fatalf("%s %s(%v) failed: %s", who, fn, args, resp.Message)
+	}
+	return resp.Payload
+}
+
+// mustFail invokes a function and fails the test unless it fails with the code
+func (e *testEnv) mustFail(code ErrCode, who, fn string, args ...string) {
+	e.t.Helper()
+	resp := e.invoke(who, fn, args...)
+	if resp.Status == shim.OK {
+		e.t.Fatalf("%s %s(%v) succeeded, expected %s", who, fn, args, code)
+	}
+	cerr := new(CodeError)
+	err := json.Unmarshal([]byte(resp.Message), cerr)
+	if err != nil || cerr.Code != code {
+		e.t.Fatalf("%s %s(%v) failed with %s, expected %s", who, fn, args, resp.Message, code)
+	}
+}
+
+// event returns the payload of an event set by the last transaction
+func (e *testEnv) event(name string, v interface{}) {
+	e.t.Helper()
+	payload, ok := e.last.events[name]
+	if !ok {
+		e.t.Fatalf("The event %s was not set", name)
+	}
+	err := json.Unmarshal(payload, v)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// assign assigns a currency from the issuer to a test user
+func (e *testEnv) assign(currency, who string, count int64) {
+	e.t.Helper()
+	e.mustInvoke("iss", "assign", fmt.Sprintf(`{"currency":"%s","assigns":[{"owner":"%s","count":%d}]}`, currency, e.acct(who), count))
+}
+
+// asset returns the committed asset of a test user, an empty one when it has none
+func (e *testEnv) asset(who, currency string) *Asset {
+	e.t.Helper()
+	c := &ExchangeChaincode{stub: e.ms}
+	asset, err := c.getOwnerOneAsset(e.acct(who), currency)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if asset == nil {
+		return &Asset{}
+	}
+	return asset
+}
+
+// checkBalance fails the test unless the user holds count and lockCount of the currency
+func (e *testEnv) checkBalance(who, currency string, count, lockCount int64) {
+	e.t.Helper()
+	asset := e.asset(who, currency)
+	if asset.Count != count || asset.LockCount != lockCount {
+		e.t.Fatalf("%s holds %d (%d locked) %s, expected %d (%d locked)", who, asset.Count, asset.LockCount, currency, count, lockCount)
+	}
+}
+
+// placeOrder places a book order and returns its ID
+func (e *testEnv) placeOrder(who, src string, srcCount int64, des string, desCount int64) string {
+	e.t.Helper()
+	order := new(Order)
+	payload := e.mustInvoke(who, "placeOrder", fmt.Sprintf(`{"srcCurrency":"%s","srcCount":%d,"desCurrency":"%s","desCount":%d}`, src, srcCount, des, desCount))
+	err := json.Unmarshal(payload, order)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return order.UUID
+}
+
+// order returns the committed book order
+func (e *testEnv) order(id string) *Order {
+	e.t.Helper()
+	c := &ExchangeChaincode{stub: e.ms}
+	order, err := c.getOrder(id)
+	if err != nil || order == nil {
+		e.t.Fatalf("The order %s can't be read: %v", id, err)
+	}
+	return order
+}
+
+// pageOf reads a Page payload, its records into records
+func pageOf(t *testing.T, payload []byte, records interface{}) string {
+	t.Helper()
+	var page struct {
+		Records  json.RawMessage `json:"records"`
+		Bookmark string          `json:"bookmark"`
+	}
+	mustUnmarshal(t, payload, &page)
+	mustUnmarshal(t, page.Records, records)
+	return page.Bookmark
+}
+
+func mustUnmarshal(t *testing.T, payload []byte, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(payload, v)
+	if err != nil {
+		t.Fatalf("Failed unmarshalling %s: %s", payload, err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Clock returns the current time in milliseconds
+type Clock interface {
+	Now(stub shim.ChaincodeStubInterface) (int64, error)
+}
+
+// TxClock reads the time from the transaction proposal, which is the same on every endorser
+type TxClock struct{}
+
+// Now returns the transaction timestamp in milliseconds
+func (TxClock) Now(stub shim.ChaincodeStubInterface) (int64, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, err
+	}
+	if ts == nil {
+		return 0, errors.New("Transaction timestamp is missing")
+	}
+
+	return ts.Seconds*1000 + int64(ts.Nanos)/1000000, nil
+}
+
+// txTime reads the transaction time from the configured clock, defaulting to TxClock
+func (c *ExchangeChaincode) txTime(stub shim.ChaincodeStubInterface) (int64, error) {
+	if c.clock == nil {
+		c.clock = TxClock{}
+	}
+	return c.clock.Now(stub)
+}
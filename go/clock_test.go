@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// timestampStub is a stub with a proposal timestamp
+type timestampStub struct {
+	*shim.MockStub
+	ts *timestamp.Timestamp
+}
+
+func (s *timestampStub) GetTxTimestamp() (*timestamp.Timestamp, error) { return s.ts, nil }
+
+func TestTxClockReturnsTheProposalTimeInMillis(t *testing.T) {
+	stub := &timestampStub{MockStub: shim.NewMockStub("exchange", nil), ts: &timestamp.Timestamp{Seconds: 1500000000, Nanos: 123999999}}
+	now, err := TxClock{}.Now(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now != 1500000000123 {
+		t.Fatalf("The time is %d", now)
+	}
+
+	stub.ts = nil
+	_, err = TxClock{}.Now(stub)
+	if err == nil {
+		t.Fatal("A transaction without a timestamp has a time")
+	}
+}
+
+func TestRecordsCarryTheTransactionTime(t *testing.T) {
+	e := newTestEnv(t)
+	e.now = 1600000000000
+	e.assign("BTC", "alice", 10)
+	if updated := e.asset("alice", "BTC").UpdateTime; updated != e.now {
+		t.Fatalf("The asset was updated at %d, expected %d", updated, e.now)
+	}
+
+	order := e.order(e.placeOrder("alice", "BTC", 10, "ETH", 20))
+	if order.PendingTime != e.now {
+		t.Fatalf("The order was placed at %d, expected %d", order.PendingTime, e.now)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Currency statuses. An empty status is active.
+const (
+	CurrencyActive   = "active"
+	CurrencyPaused   = "paused"
+	CurrencyFrozen   = "frozen"
+	CurrencyDelisted = "delisted"
+)
+
+// currencyStatus returns the status of the currency, active when unset
+func (curr *Currency) currencyStatus() string {
+	if curr.Status == "" {
+		return CurrencyActive
+	}
+	return curr.Status
+}
+
+// canTrade reports whether the currency can be locked and exchanged
+func (curr *Currency) canTrade() bool {
+	return curr.currencyStatus() == CurrencyActive
+}
+
+// canAssign reports whether the issuer can assign the currency
+func (curr *Currency) canAssign() bool {
+	s := curr.currencyStatus()
+	return s == CurrencyActive || s == CurrencyPaused
+}
+
+// canTransfer reports whether holders can move or redeem the currency
+func (curr *Currency) canTransfer() bool {
+	return curr.currencyStatus() != CurrencyFrozen
+}
+
+// checkCurrencyAllows returns an error unless the currency exists and allows the operation
+func (c *ExchangeChaincode) checkCurrencyAllows(name, operation string, allowed func(*Currency) bool) error {
+	curr, err := c.getCurrencyByName(name)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", name, err)
+	}
+	if curr == nil {
+		return newError(CodeCurrencyNotFound, "The currency [%s] does not exist", name).With("currency", name)
+	}
+	return curr.allows(operation, allowed)
+}
+
+// allows returns an error unless the status of the currency allows the operation
+func (curr *Currency) allows(operation string, allowed func(*Currency) bool) error {
+	if allowed(curr) {
+		return nil
+	}
+	return newError(CodeCurrencyUnavailable, "The currency [%s] is %s and can't %s", curr.Name, curr.currencyStatus(), operation).
+		With("currency", curr.Name).With("status", curr.currencyStatus())
+}
+
+// setCurrencyStatus change the status of a currency, by its issuer or an admin.
+// Only an admin can freeze or unfreeze a currency, change a delisted currency
+// or lift a status set by an admin.
+// args: currency id, status, reason
+func (c *ExchangeChaincode) setCurrencyStatus() pb.Response {
+	myLogger.Debug("Set Currency Status...")
+
+	id := c.args[0]
+	status := c.args[1]
+	reason := c.args[2]
+
+	if status != CurrencyActive && status != CurrencyPaused && status != CurrencyFrozen && status != CurrencyDelisted {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid currency status [%s]", status).With("status", status))
+	}
+
+	curr, err := c.getCurrencyByName(id)
+	if err != nil {
+		myLogger.Errorf("setCurrencyStatus error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", id, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", id).With("currency", id))
+	}
+
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	adminErr := c.checkRole(caller, RoleAdmin)
+	if caller != curr.Creator || curr.StatusAdmin || status == CurrencyFrozen ||
+		curr.currencyStatus() == CurrencyFrozen || curr.currencyStatus() == CurrencyDelisted {
+		if adminErr != nil {
+			return errorResponse(adminErr)
+		}
+	}
+	if curr.currencyStatus() == status {
+		return errorResponse(newError(CodeInvalidArgument, "The currency [%s] is already %s", id, status).
+			With("currency", id).With("status", status))
+	}
+
+	log := &CurrencyStatusLog{
+		Currency:   id,
+		From:       curr.currencyStatus(),
+		To:         status,
+		Reason:     reason,
+		Operator:   caller,
+		ChangeTime: c.now,
+	}
+
+	curr.Status = status
+	curr.StatusAdmin = adminErr == nil && status != CurrencyActive
+	err = c.putCurrency(curr)
+	if err != nil {
+		myLogger.Errorf("setCurrencyStatus error2:%s", err)
+		return errorResponse(err)
+	}
+
+	err = c.putCurrencyStatusLog(log)
+	if err != nil {
+		myLogger.Errorf("setCurrencyStatus error3:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(log)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_currencyStatus", payload)
+
+	myLogger.Debug("Set Currency Status...done")
+	return shim.Success(payload)
+}
+
+// queryCurrencyStatusLog
+// args: currency id, [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryCurrencyStatusLog() pb.Response {
+	myLogger.Debug("queryCurrencyStatusLog...")
+
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var logs []*CurrencyStatusLog
+	next, err := c.getPage(keyRange{"CurrencyStatusLog~currency~uuid", []string{c.args[0]}}, 1, pageSize, bookmark, &logs)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
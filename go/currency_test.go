@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// currency returns the committed currency
+func (e *testEnv) currency(name string) *Currency {
+	e.t.Helper()
+	curr := new(Currency)
+	mustUnmarshal(e.t, e.mustInvoke("alice", "queryCurrencyByID", name), curr)
+	return curr
+}
+
+func TestBurnDestroysUnassignedSupply(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 400000)
+
+	e.mustFail(CodeUnauthorized, "alice", "burn", "BTC", "10")
+	e.mustFail(CodeInsufficientSupply, "iss", "burn", "BTC", "600001")
+	e.mustFail(CodeInvalidArgument, "iss", "burn", "BTC", "0")
+	e.mustInvoke("iss", "burn", "BTC", "100000")
+
+	curr := e.currency("BTC")
+	if curr.Count != 900000 || curr.LeftCount != 500000 {
+		t.Fatalf("BTC has count %d and left count %d", curr.Count, curr.LeftCount)
+	}
+	e.checkBalance("alice", "BTC", 400000, 0)
+}
+
+func TestRedeemReturnsAssignedSupply(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.placeOrder("alice", "BTC", 60, "ETH", 60)
+
+	// only the available balance is redeemed
+	e.mustFail(CodeInsufficientBalance, "alice", "redeem", "BTC", "41")
+	e.mustFail(CodeAssetNotFound, "bob", "redeem", "BTC", "1")
+	e.mustInvoke("alice", "redeem", "BTC", "30")
+
+	e.checkBalance("alice", "BTC", 10, 60)
+	curr := e.currency("BTC")
+	if curr.Count != 999970 || curr.LeftCount != 999900 {
+		t.Fatalf("BTC has count %d and left count %d", curr.Count, curr.LeftCount)
+	}
+}
+
+func TestCreateKeepsMetadataAndTheSupplyCap(t *testing.T) {
+	e := newTestEnv(t)
+
+	e.mustFail(CodeInvalidArgument, "iss", "create", `{"name":"LTC","count":10,"decimals":19}`)
+	e.mustFail(CodeInvalidArgument, "iss", "create", `{"name":"","count":10}`)
+	e.mustFail(CodeSupplyCapExceeded, "iss", "create", `{"name":"LTC","count":101,"maxSupply":100}`)
+	e.mustFail(CodeCurrencyExists, "iss", "create", `{"name":"BTC","count":10}`)
+
+	e.mustInvoke("iss", "create", `{"name":"LTC","count":60,"maxSupply":100,"decimals":8,"displayName":"Litecoin","symbol":"Ł","description":"test coin","issuerContact":"iss@example.com"}`)
+	curr := e.currency("LTC")
+	if curr.Decimals != 8 || curr.MaxSupply != 100 || curr.DisplayName != "Litecoin" || curr.Symbol != "Ł" ||
+		curr.Description != "test coin" || curr.IssuerContact != "iss@example.com" || curr.Creator != e.acct("iss") {
+		t.Fatalf("LTC is %+v", curr)
+	}
+
+	// release can't go over the cap
+	e.mustFail(CodeSupplyCapExceeded, "iss", "release", "LTC", "41")
+	e.mustInvoke("iss", "release", "LTC", "40")
+	if curr = e.currency("LTC"); curr.Count != 100 || curr.LeftCount != 100 {
+		t.Fatalf("LTC has count %d and left count %d", curr.Count, curr.LeftCount)
+	}
+
+	// Init creates CNY and USD with 2 decimals
+	if cny := e.currency(CNY); cny.Decimals != 2 || cny.Symbol != "¥" {
+		t.Fatalf("CNY is %+v", cny)
+	}
+}
+
+func TestInitKeepsTheExistingCurrencies(t *testing.T) {
+	e := newTestEnv(t)
+	created := e.currency(CNY).CreateTime
+	e.now += 1000
+
+	resp := e.call(true, "admin", "")
+	if resp.Status != shim.OK {
+		t.Fatalf("Init failed: %s", resp.Message)
+	}
+
+	var currencies []*Currency
+	pageOf(t, e.mustInvoke("alice", "queryAllCurrency"), &currencies)
+	if len(currencies) != 4 {
+		t.Fatalf("queryAllCurrency listed %d currencies", len(currencies))
+	}
+	if e.currency(CNY).CreateTime != created {
+		t.Fatal("Init recreated CNY")
+	}
+}
+
+func TestIssuerCantLiftAnAdminStatus(t *testing.T) {
+	e := newTestEnv(t)
+
+	// only an admin freezes or unfreezes
+	e.mustFail(CodeUnauthorized, "iss", "setCurrencyStatus", "BTC", CurrencyFrozen, "test")
+	e.mustInvoke("admin", "setCurrencyStatus", "BTC", CurrencyFrozen, "test")
+	e.mustFail(CodeUnauthorized, "iss", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+	e.mustFail(CodeUnauthorized, "iss", "setCurrencyStatus", "BTC", CurrencyPaused, "test")
+	e.mustInvoke("admin", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+
+	// a pause by an admin is lifted by an admin
+	e.mustInvoke("admin", "setCurrencyStatus", "BTC", CurrencyPaused, "test")
+	e.mustFail(CodeUnauthorized, "iss", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+	e.mustInvoke("admin", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+
+	// the issuer pauses and resumes its own currency
+	e.mustInvoke("iss", "setCurrencyStatus", "BTC", CurrencyPaused, "test")
+	e.mustInvoke("iss", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+
+	// a change to the current status is rejected
+	e.mustFail(CodeInvalidArgument, "iss", "setCurrencyStatus", "BTC", CurrencyActive, "test")
+	e.mustFail(CodeUnauthorized, "iss", "setCurrencyStatus", "ETH", CurrencyFrozen, "test")
+	e.mustInvoke("admin", "setCurrencyStatus", "ETH", CurrencyFrozen, "test")
+	e.mustFail(CodeInvalidArgument, "admin", "setCurrencyStatus", "ETH", CurrencyFrozen, "test")
+}
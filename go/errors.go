@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ErrCode is a stable error code clients can branch on
+type ErrCode string
+
+const (
+	CodeInternal              = ErrCode("INTERNAL_ERROR")
+	CodeUnknownFunction       = ErrCode("UNKNOWN_FUNCTION")
+	CodeInvalidArgument       = ErrCode("INVALID_ARGUMENT")
+	CodeUnauthorized          = ErrCode("UNAUTHORIZED")
+	CodeNotFound              = ErrCode("NOT_FOUND")
+	CodeCurrencyNotFound      = ErrCode("CURRENCY_NOT_FOUND")
+	CodeCurrencyExists        = ErrCode("CURRENCY_EXISTS")
+	CodeCurrencyUnavailable   = ErrCode("CURRENCY_UNAVAILABLE")
+	CodeAccountUnavailable    = ErrCode("ACCOUNT_UNAVAILABLE")
+	CodeLimitExceeded         = ErrCode("LIMIT_EXCEEDED")
+	CodeAssetNotFound         = ErrCode("ASSET_NOT_FOUND")
+	CodeInsufficientBalance   = ErrCode("INSUFFICIENT_BALANCE")
+	CodeInsufficientLocked    = ErrCode("INSUFFICIENT_LOCKED_BALANCE")
+	CodeInsufficientSupply    = ErrCode("INSUFFICIENT_SUPPLY")
+	CodeSupplyCapExceeded     = ErrCode("SUPPLY_CAP_EXCEEDED")
+	CodeInsufficientAllowance = ErrCode("INSUFFICIENT_ALLOWANCE")
+	CodeAlreadyExecuted       = ErrCode("ALREADY_EXECUTED")
+	CodeInvalidExchange       = ErrCode("INVALID_EXCHANGE")
+	CodeLockNotFound          = ErrCode("LOCK_NOT_FOUND")
+	CodePriceLimit            = ErrCode("PRICE_LIMIT_EXCEEDED")
+	CodeOverfilled            = ErrCode("ORDER_OVERFILLED")
+	CodeOrderExpired          = ErrCode("ORDER_EXPIRED")
+	CodeLockExpired           = ErrCode("LOCK_EXPIRED")
+	CodeSelfTrade             = ErrCode("SELF_TRADE")
+)
+
+// CodeError is the error model returned in responses and batch results
+type CodeError struct {
+	Code    ErrCode                `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *CodeError) Error() string {
+	return e.Message
+}
+
+// With adds a detail to the error
+func (e *CodeError) With(key string, value interface{}) *CodeError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+func newError(code ErrCode, format string, a ...interface{}) *CodeError {
+	return &CodeError{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// toCodeError keeps typed errors and wraps any other error as an internal error
+func toCodeError(err error) *CodeError {
+	if e, ok := err.(*CodeError); ok {
+		return e
+	}
+	return &CodeError{Code: CodeInternal, Message: err.Error()}
+}
+
+// errorResponse returns the error as JSON in the response message
+func errorResponse(err error) pb.Response {
+	e := toCodeError(err)
+	payload, merr := json.Marshal(e)
+	if merr != nil {
+		return shim.Error(e.Message)
+	}
+	return shim.Error(string(payload))
+}
+
+// newFailInfo builds a batch failure entry from an error
+func newFailInfo(id string, err error) FailInfo {
+	e := toCodeError(err)
+	return FailInfo{Id: id, Code: e.Code, Info: e.Message, Details: e.Details}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestErrorResponseIsCodeMessageAndDetails(t *testing.T) {
+	resp := errorResponse(newError(CodeInsufficientBalance, "Not enough [%s]", "BTC").With("currency", "BTC").With("required", 5))
+	if resp.Status == 200 {
+		t.Fatal("An error response has status OK")
+	}
+
+	var body map[string]interface{}
+	mustUnmarshal(t, []byte(resp.Message), &body)
+	if len(body) != 3 || body["code"] != "INSUFFICIENT_BALANCE" || body["message"] != "Not enough [BTC]" {
+		t.Fatalf("The error is %s", resp.Message)
+	}
+	details, _ := body["details"].(map[string]interface{})
+	if details["currency"] != "BTC" || details["required"] != float64(5) {
+		t.Fatalf("The details are %v", body["details"])
+	}
+
+	// plain errors are internal errors without details
+	resp = errorResponse(errors.New("disk full"))
+	if resp.Message != `{"code":"INTERNAL_ERROR","message":"disk full"}` {
+		t.Fatalf("The error is %s", resp.Message)
+	}
+}
+
+func TestBatchFailuresCarryTheErrorCode(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A1","count":10,"desCurrency":"ETH","desCount":20}]`, "true", "test")
+
+	var raw struct {
+		Fail []map[string]json.RawMessage `json:"fail"`
+	}
+	e.event("chaincode_lock", &raw)
+	if len(raw.Fail) != 1 {
+		t.Fatalf("The batch failed %d entries", len(raw.Fail))
+	}
+	for _, field := range []string{"id", "code", "info", "details"} {
+		if _, ok := raw.Fail[0][field]; !ok {
+			t.Fatalf("The failure has no %s: %v", field, raw.Fail[0])
+		}
+	}
+	if string(raw.Fail[0]["id"]) != `"A1"` {
+		t.Fatalf("The failure is for %s", raw.Fail[0]["id"])
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// FeeSchedule is the trading fee of a currency pair in basis points of the received count.
+// With FeeCurrency set only the side receiving that currency pays the fee.
+type FeeSchedule struct {
+	SrcCurrency string `json:"srcCurrency"`
+	DesCurrency string `json:"desCurrency"`
+	MakerBps    int64  `json:"makerBps"`
+	TakerBps    int64  `json:"takerBps"`
+	MinFee      int64  `json:"minFee"`
+	FeeCurrency string `json:"feeCurrency"`
+}
+
+// FeeTotal is the sum of the fees collected in a currency
+type FeeTotal struct {
+	Currency string `json:"currency"`
+	Total    int64  `json:"total"`
+	Count    int64  `json:"count"`
+}
+
+// FeeReport FeeReport
+type FeeReport struct {
+	Collector string      `json:"collector"`
+	Totals    []*FeeTotal `json:"totals"`
+}
+
+// pairKey returns the currencies of a pair in a fixed order
+func pairKey(a, b string) []string {
+	if a > b {
+		a, b = b, a
+	}
+	return []string{a, b}
+}
+
+// computeFee sets the fee the order pays on its DesCount when it trades against other
+func (c *ExchangeChaincode) computeFee(order, other *Order) error {
+	order.Fee = 0
+	order.FeeCurrency = ""
+
+	collector, err := c.getFeeCollector()
+	if err != nil {
+		return err
+	}
+	if collector == "" {
+		return nil
+	}
+
+	schedule, err := c.getFeeSchedule(order.SrcCurrency, order.DesCurrency)
+	if err != nil {
+		return err
+	}
+	if schedule == nil || (schedule.FeeCurrency != "" && schedule.FeeCurrency != order.DesCurrency) {
+		return nil
+	}
+
+	// the order locked first on chain is the maker
+	lockTime, err := c.orderLockTime(order)
+	if err != nil {
+		return err
+	}
+	otherLockTime, err := c.orderLockTime(other)
+	if err != nil {
+		return err
+	}
+	bps := schedule.TakerBps
+	if lockTime < otherLockTime {
+		bps = schedule.MakerBps
+	}
+
+	fee := mulDiv(order.DesCount, bps, 10000, true)
+	if fee < schedule.MinFee {
+		fee = schedule.MinFee
+	}
+	if fee > order.DesCount {
+		fee = order.DesCount
+	}
+
+	order.Fee = fee
+	order.FeeCurrency = order.DesCurrency
+	return nil
+}
+
+// orderLockTime returns when the source of the raw order of a fill was locked
+func (c *ExchangeChaincode) orderLockTime(order *Order) (int64, error) {
+	lockLog, err := c.getLockLogByParm(order.Account, order.SrcCurrency, order.RawUUID, true)
+	if err != nil {
+		return 0, err
+	}
+	if lockLog == nil {
+		return 0, newError(CodeLockNotFound, "The order [%s] is not locked", order.RawUUID).With("orderId", order.RawUUID)
+	}
+	return lockLog.LockTime, nil
+}
+
+// checkFeeCollector returns an error unless the fee collector can be credited
+// the fees of the orders
+func (c *ExchangeChaincode) checkFeeCollector(orders ...*Order) error {
+	for _, order := range orders {
+		if order.Fee <= 0 {
+			continue
+		}
+		collector, err := c.getFeeCollector()
+		if err != nil {
+			return newError(CodeInternal, "Failed retrieving fee collector: [%s]", err)
+		}
+		return c.checkAccountActive(collector)
+	}
+	return nil
+}
+
+// creditFee credits the fee paid by an order to the fee collector
+func (c *ExchangeChaincode) creditFee(order *Order) error {
+	if order.Fee <= 0 {
+		return nil
+	}
+
+	collector, err := c.getFeeCollector()
+	if err != nil {
+		return err
+	}
+
+	asset, err := c.getOwnerOneAsset(collector, order.FeeCurrency)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		asset = &Asset{Owner: collector, Currency: order.FeeCurrency}
+	}
+	asset.Count += order.Fee
+	err = c.putAsset(asset)
+	if err != nil {
+		return err
+	}
+
+	total, err := c.getFeeTotal(order.FeeCurrency)
+	if err != nil {
+		return err
+	}
+	total.Total += order.Fee
+	total.Count++
+	return c.putFeeTotal(total)
+}
+
+// setFeeSchedule set the fee schedule of a currency pair
+// args: json{srcCurrency, desCurrency, makerBps, takerBps, minFee, feeCurrency}
+func (c *ExchangeChaincode) setFeeSchedule() pb.Response {
+	myLogger.Debug("Set Fee Schedule...")
+
+	schedule := new(FeeSchedule)
+	err := json.Unmarshal([]byte(c.args[0]), schedule)
+	if err != nil {
+		myLogger.Errorf("setFeeSchedule error1:%s", err)
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling fee schedule: [%s]", err))
+	}
+
+	if schedule.SrcCurrency == "" || schedule.SrcCurrency == schedule.DesCurrency {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid currency pair [%s/%s]", schedule.SrcCurrency, schedule.DesCurrency))
+	}
+	if schedule.MakerBps < 0 || schedule.MakerBps > 10000 || schedule.TakerBps < 0 || schedule.TakerBps > 10000 || schedule.MinFee < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The fee rates must be between 0 and 10000 bps and the min fee >= 0"))
+	}
+	if schedule.FeeCurrency != "" && schedule.FeeCurrency != schedule.SrcCurrency && schedule.FeeCurrency != schedule.DesCurrency {
+		return errorResponse(newError(CodeInvalidArgument, "The fee currency must be one of the pair"))
+	}
+
+	err = c.putFeeSchedule(schedule)
+	if err != nil {
+		myLogger.Errorf("setFeeSchedule error2:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Set Fee Schedule...done")
+	return shim.Success(nil)
+}
+
+// setFeeCollector set the account collecting trading fees
+// args: account
+func (c *ExchangeChaincode) setFeeCollector() pb.Response {
+	myLogger.Debug("Set Fee Collector...")
+
+	collector := c.args[0]
+	err := checkAccountID(collector)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = c.checkAccountActive(collector)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = c.putFeeCollector(collector)
+	if err != nil {
+		myLogger.Errorf("setFeeCollector error1:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Set Fee Collector...done")
+	return shim.Success(nil)
+}
+
+// queryFeeSchedule
+// args: srcCurrency, desCurrency
+func (c *ExchangeChaincode) queryFeeSchedule() pb.Response {
+	myLogger.Debug("queryFeeSchedule...")
+
+	schedule, err := c.getFeeSchedule(c.args[0], c.args[1])
+	if err != nil {
+		return errorResponse(err)
+	}
+	if schedule == nil {
+		return errorResponse(NoDataErr)
+	}
+
+	payload, err := json.Marshal(schedule)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// queryFeeReport report the fees collected per currency
+// args: [currency]
+func (c *ExchangeChaincode) queryFeeReport() pb.Response {
+	myLogger.Debug("queryFeeReport...")
+
+	collector, err := c.getFeeCollector()
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	report := &FeeReport{Collector: collector}
+	if len(c.args) > 0 && c.args[0] != "" {
+		total, err := c.getFeeTotal(c.args[0])
+		if err != nil {
+			return errorResponse(err)
+		}
+		report.Totals = []*FeeTotal{total}
+	} else {
+		report.Totals, err = c.getAllFeeTotal()
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
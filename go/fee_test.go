@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFeesFollowTheLockTimes(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "setFeeCollector", e.acct("fees"))
+	e.mustInvoke("admin", "setFeeSchedule", `{"srcCurrency":"BTC","desCurrency":"ETH","makerBps":10,"takerBps":100}`)
+	e.assign("BTC", "alice", 1000)
+	e.assign("ETH", "bob", 2000)
+
+	// alice locks first and is the maker
+	e.lockFor("alice", "A1", "BTC", 1000, "ETH", 2000)
+	e.now++
+	e.lockFor("bob", "B1", "ETH", 2000, "BTC", 1000)
+
+	// a PendingTime in the payload doesn't make bob the maker
+	pair := e.pairJSON(fill{"bob", "B1-1", "B1", 2000, 1000, 0}, fill{"alice", "A1-1", "A1", 1000, 2000, 0})
+	pair = strings.Replace(pair, `{"uuid":"B1-1"`, `{"PendingTime":1,"uuid":"B1-1"`, 1)
+	checkBatch(t, e.exchange(pair), 1)
+
+	e.checkBalance("alice", "ETH", 1998, 0)
+	e.checkBalance("bob", "BTC", 990, 0)
+	e.checkBalance("fees", "ETH", 2, 0)
+	e.checkBalance("fees", "BTC", 10, 0)
+}
+
+func TestFeeCollectorMustBeAnActiveAccount(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustFail(CodeInvalidArgument, "admin", "setFeeCollector", "fees")
+	e.mustFail(CodeInvalidArgument, "admin", "setFeeCollector", "Org1MSP::")
+
+	e.mustInvoke("admin", "setAccountStatus", e.acct("fees"), AccountFrozen, "test")
+	e.mustFail(CodeAccountUnavailable, "admin", "setFeeCollector", e.acct("fees"))
+}
+
+func TestFrozenFeeCollectorFailsOnlyThePairsWithFees(t *testing.T) {
+	e := newExchangeEnv(t)
+	e.mustInvoke("admin", "setFeeCollector", e.acct("fees"))
+	e.mustInvoke("admin", "setFeeSchedule", `{"srcCurrency":"BTC","desCurrency":"ETH","makerBps":100,"takerBps":100}`)
+	e.mustInvoke("admin", "setAccountStatus", e.acct("fees"), AccountFrozen, "test")
+
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 20, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}))
+	checkBatch(t, batch, 0, CodeAccountUnavailable)
+	e.checkBalance("alice", "BTC", 90, 10)
+	e.checkBalance("bob", "ETH", 60, 40)
+}
+
+func TestQueryFeeReportTreatsAnEmptyCurrencyAsAll(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "setFeeCollector", e.acct("fees"))
+
+	all, empty := new(FeeReport), new(FeeReport)
+	mustUnmarshal(t, e.mustInvoke("admin", "queryFeeReport"), all)
+	mustUnmarshal(t, e.mustInvoke("admin", "queryFeeReport", ""), empty)
+	if len(empty.Totals) != len(all.Totals) {
+		t.Fatalf("queryFeeReport with an empty currency returned %+v, expected %+v", empty.Totals, all.Totals)
+	}
+}
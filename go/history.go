@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// AssetVersion is one past value of an asset. The history iterator of this
+// Fabric version returns the tx ID and the value only, so Timestamp is the
+// UpdateTime written by putAsset.
+type AssetVersion struct {
+	TxID      string `json:"txID"`
+	Timestamp int64  `json:"timestamp"`
+	Count     int64  `json:"count"`
+	LockCount int64  `json:"lockCount"`
+}
+
+type assetVersions []*AssetVersion
+
+func (v assetVersions) Len() int           { return len(v) }
+func (v assetVersions) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v assetVersions) Less(i, j int) bool { return v[i].Timestamp < v[j].Timestamp }
+
+// scanAssetHistory calls fn with the versions of the owner's asset of a currency,
+// in commit order, until fn returns false
+func (c *ExchangeChaincode) scanAssetHistory(owner, currency string, fn func(v *AssetVersion) bool) error {
+	asset, err := c.getOwnerOneAsset(owner, currency)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		return nil
+	}
+
+	resultsIterator, err := c.stub.GetHistoryForKey(asset.UUID)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		txID, value, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if len(value) == 0 {
+			continue
+		}
+
+		a := new(Asset)
+		err = json.Unmarshal(value, a)
+		if err != nil {
+			return err
+		}
+		if !fn(&AssetVersion{TxID: txID, Timestamp: a.UpdateTime, Count: a.Count, LockCount: a.LockCount}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// getAssetHistory returns the versions of the owner's asset of a currency, oldest first
+func (c *ExchangeChaincode) getAssetHistory(owner, currency string) ([]*AssetVersion, error) {
+	var versions []*AssetVersion
+	err := c.scanAssetHistory(owner, currency, func(v *AssetVersion) bool {
+		versions = append(versions, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Stable(assetVersions(versions))
+	return versions, nil
+}
+
+// queryAssetHistory returns a page of the versions of an account's balance of a
+// currency, in commit order. The bookmark is the tx ID of the last version of a page.
+// args: currency, [owner] (auditor only), [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryAssetHistory() pb.Response {
+	myLogger.Debug("queryAssetHistory...")
+
+	currency := c.args[0]
+	owner, err := c.getAuditAccount(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	pageSize, bookmark, err := c.getPaging(2)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	versions := []*AssetVersion{}
+	next := ""
+	found := bookmark == ""
+	err = c.scanAssetHistory(owner, currency, func(v *AssetVersion) bool {
+		if !found {
+			found = v.TxID == bookmark
+			return true
+		}
+		if len(versions) == pageSize {
+			next = encodeBookmark(versions[len(versions)-1].TxID)
+			return false
+		}
+		versions = append(versions, v)
+		return true
+	})
+	if err != nil {
+		myLogger.Errorf("queryAssetHistory error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving history of [%s] [%s]: [%s]", owner, currency, err))
+	}
+	if !found {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid bookmark"))
+	}
+
+	payload, err := json.Marshal(&Page{Records: versions, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// balanceAt returns an account's balance of a currency as of a timestamp,
+// the version written last at or before it. An account without one has nothing.
+// args: currency, timestamp, [owner] (auditor only)
+func (c *ExchangeChaincode) balanceAt() pb.Response {
+	myLogger.Debug("balanceAt...")
+
+	currency := c.args[0]
+	timestamp, _ := strconv.ParseInt(c.args[1], 10, 64)
+	owner, err := c.getAuditAccount(2)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	versions, err := c.getAssetHistory(owner, currency)
+	if err != nil {
+		myLogger.Errorf("balanceAt error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving history of [%s] [%s]: [%s]", owner, currency, err))
+	}
+
+	balance := &AssetVersion{}
+	for _, v := range versions {
+		if v.Timestamp > timestamp {
+			break
+		}
+		balance = v
+	}
+
+	payload, err := json.Marshal(balance)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
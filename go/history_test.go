@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBalanceAtReturnsTheVersionAtOrBeforeTheTimestamp(t *testing.T) {
+	e := newTestEnv(t)
+	start := e.now
+	e.now = start + 1000
+	e.assign("BTC", "alice", 10)
+	e.now = start + 2000
+	e.assign("BTC", "alice", 10)
+
+	for _, c := range []struct {
+		at    int64
+		count int64
+	}{
+		{start + 999, 0},
+		{start + 1000, 10},
+		{start + 1999, 10},
+		{start + 2000, 20},
+		{start + 9999, 20},
+	} {
+		balance := new(AssetVersion)
+		mustUnmarshal(t, e.mustInvoke("alice", "balanceAt", "BTC", fmt.Sprint(c.at)), balance)
+		if balance.Count != c.count {
+			t.Fatalf("balanceAt %d returned %+v, expected %d", c.at, balance, c.count)
+		}
+		if c.count == 0 && balance.TxID != "" {
+			t.Fatalf("balanceAt %d returned a version before the first one: %+v", c.at, balance)
+		}
+	}
+
+	balance := new(AssetVersion)
+	mustUnmarshal(t, e.mustInvoke("alice", "balanceAt", "ETH", fmt.Sprint(start+9999)), balance)
+	if *balance != (AssetVersion{}) {
+		t.Fatalf("balanceAt of a currency without an asset returned %+v", balance)
+	}
+}
+
+func TestQueryAssetHistoryListsTheVersions(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 30)
+	e.now += 1000
+	e.placeOrder("alice", "BTC", 10, "ETH", 20)
+
+	var versions []*AssetVersion
+	pageOf(t, e.mustInvoke("alice", "queryAssetHistory", "BTC"), &versions)
+	if len(versions) != 2 {
+		t.Fatalf("queryAssetHistory returned %d versions", len(versions))
+	}
+	if versions[0].Count != 30 || versions[0].LockCount != 0 || versions[1].Count != 20 || versions[1].LockCount != 10 {
+		t.Fatalf("queryAssetHistory returned %+v %+v", versions[0], versions[1])
+	}
+	if versions[0].TxID == "" || versions[1].Timestamp != versions[0].Timestamp+1000 {
+		t.Fatalf("queryAssetHistory returned %+v %+v", versions[0], versions[1])
+	}
+
+	e.mustFail(CodeUnauthorized, "bob", "queryAssetHistory", "BTC", e.acct("alice"))
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+	versions = nil
+	pageOf(t, e.mustInvoke("aud", "queryAssetHistory", "BTC", e.acct("alice")), &versions)
+	if len(versions) != 2 {
+		t.Fatalf("The auditor read %d versions", len(versions))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/msp"
+)
+
+// getCaller returns the account ID of the identity that signed the proposal
+func (c *ExchangeChaincode) getCaller() (string, error) {
+	if c.caller != "" {
+		return c.caller, nil
+	}
+
+	creator, err := c.stub.GetCreator()
+	if err != nil {
+		return "", err
+	}
+
+	caller, err := accountID(creator)
+	if err != nil {
+		return "", newError(CodeUnauthorized, "Failed resolving caller identity: [%s]", err)
+	}
+	c.caller = caller
+
+	return caller, nil
+}
+
+// accountID derives the canonical account ID (MSPID::subject) from a serialized MSP identity.
+// The subject is the full distinguished name of the certificate in RFC 2253 form.
+func accountID(creator []byte) (string, error) {
+	if len(creator) == 0 {
+		return "", errors.New("The creator of the transaction is empty")
+	}
+
+	sid := &msp.SerializedIdentity{}
+	err := proto.Unmarshal(creator, sid)
+	if err != nil {
+		return "", fmt.Errorf("Failed unmarshalling creator identity: [%s]", err)
+	}
+
+	block, _ := pem.Decode(sid.IdBytes)
+	if block == nil {
+		return "", errors.New("Failed decoding creator certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("Failed parsing creator certificate: [%s]", err)
+	}
+
+	return sid.Mspid + "::" + cert.Subject.String(), nil
+}
+
+// checkAccountID returns an error unless the account has the form MSPID::subject
+func checkAccountID(account string) error {
+	parts := strings.SplitN(account, "::", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return newError(CodeInvalidArgument, "Invalid account [%s]", account).With("account", account)
+	}
+	return nil
+}
+
+// getAccount returns the caller's account, or the account in args[index] when
+// it is given and the caller is an operator acting on behalf of that user
+func (c *ExchangeChaincode) getAccount(index int) (string, error) {
+	caller, err := c.getCaller()
+	if err != nil {
+		return "", err
+	}
+
+	if len(c.args) <= index || c.args[index] == "" || c.args[index] == caller {
+		return caller, nil
+	}
+
+	ok, err := c.hasRole(caller, RoleOperator)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", newError(CodeUnauthorized, "The caller [%s] is not allowed to act on behalf of [%s]", caller, c.args[index]).
+			With("account", c.args[index])
+	}
+
+	return c.args[index], nil
+}
+
+// getAuditAccount returns the caller's account, or the account in args[index] when
+// it is given and the caller is an auditor
+func (c *ExchangeChaincode) getAuditAccount(index int) (string, error) {
+	caller, err := c.getCaller()
+	if err != nil {
+		return "", err
+	}
+
+	if len(c.args) <= index || c.args[index] == "" || c.args[index] == caller {
+		return caller, nil
+	}
+
+	err = c.checkRole(caller, RoleAuditor)
+	if err != nil {
+		return "", err
+	}
+
+	return c.args[index], nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestAccountIDUsesTheWholeSubject(t *testing.T) {
+	subjects := []pkix.Name{
+		{CommonName: "alice", Organization: []string{"org1"}},
+		{CommonName: "alice", Organization: []string{"org1"}, SerialNumber: "2"},
+		{CommonName: "alice", Organization: []string{"org1"}, StreetAddress: []string{"Main St"}},
+		{CommonName: "alice", Organization: []string{"org1"}, PostalCode: []string{"1000"}},
+	}
+
+	seen := map[string]bool{}
+	for _, subject := range subjects {
+		account, err := accountID(serializedIdentity(t, subject))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[account] {
+			t.Fatalf("The subjects share the account %s", account)
+		}
+		seen[account] = true
+	}
+
+	account, _ := accountID(serializedIdentity(t, subjects[1]))
+	if account != "Org1MSP::SERIALNUMBER=2,CN=alice,O=org1" {
+		t.Fatalf("The account is %s", account)
+	}
+}
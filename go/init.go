@@ -1,36 +1,33 @@
 package main
 
-import (
-	"time"
-)
-
 const (
 	CNY = "CNY"
 	USD = "USD"
 )
 
+// initCurrency creates the fiat currencies missing from the state
 func (c *ExchangeChaincode) initCurrency() error {
-
-	err := c.putCurrency(&Currency{
-		Name:       CNY,
-		Count:      0,
-		LeftCount:  0,
-		Creator:    "system",
-		CreateTime: time.Now().Unix(),
-	})
-	if err != nil {
-		return err
+	currencies := []*Currency{
+		{Name: CNY, DisplayName: "Chinese Yuan", Symbol: "¥", Decimals: 2},
+		{Name: USD, DisplayName: "US Dollar", Symbol: "$", Decimals: 2},
 	}
 
-	err = c.putCurrency(&Currency{
-		Name:       USD,
-		Count:      0,
-		LeftCount:  0,
-		Creator:    "system",
-		CreateTime: time.Now().Unix(),
-	})
-	if err != nil {
-		return err
+	for _, curr := range currencies {
+		// a later Init keeps the currencies it finds
+		existing, err := c.getCurrencyByName(curr.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+
+		curr.Creator = "system"
+		curr.CreateTime = c.now
+		err = c.putCurrency(curr)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
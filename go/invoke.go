@@ -2,24 +2,23 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 type FailInfo struct {
-	Id   string `json:"id"`
-	Info string `json:"info"`
+	Id      string                 `json:"id"`
+	Code    ErrCode                `json:"code"`
+	Info    string                 `json:"info"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 type BatchResult struct {
 	EventName string     `json:"eventName"`
 	SrcMethod string     `json:"srcMethod"`
-	Success   []string   `json:""success`
+	Success   []string   `json:"success"`
 	Fail      []FailInfo `json:"fail"`
 }
 
@@ -31,26 +30,36 @@ const (
 )
 
 var (
-	ExecedErr = errors.New("execed")
-	NoDataErr = errors.New("No row data")
+	ExecedErr = newError(CodeAlreadyExecuted, "execed")
+	NoDataErr = newError(CodeNotFound, "No row data")
 )
 
 // initAccount init account (CNY/USD currency) when user first login
-// args: user
+// args: [user] (operator only)
 func (c *ExchangeChaincode) initAccount() pb.Response {
 	myLogger.Debug("Init account...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	user, err := c.getAccount(0)
+	if err != nil {
+		myLogger.Errorf("initAccount error0:%s", err)
+		return errorResponse(err)
 	}
 
-	user := c.args[0]
+	info, err := c.getAccountInfo(user)
+	if err != nil {
+		myLogger.Errorf("initAccount error2:%s", err)
+		return errorResponse(err)
+	}
+	if info.Status == AccountClosed {
+		return errorResponse(newError(CodeAccountUnavailable, "The account [%s] is closed", user).
+			With("account", user).With("status", info.Status))
+	}
 
 	// find CNY of the user
 	asset, err := c.getOwnerOneAsset(user, CNY)
 	if err != nil {
 		myLogger.Errorf("initAccount error1:%s", err)
-		return shim.Error(fmt.Sprintf("Failed retrieving asset [%s] of the user: [%s]", CNY, err))
+		return errorResponse(newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", CNY, err))
 	}
 	if asset == nil || asset.UUID == "" {
 		err = c.putAsset(&Asset{
@@ -60,7 +69,7 @@ func (c *ExchangeChaincode) initAccount() pb.Response {
 			LockCount: 0,
 		})
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 	}
 
@@ -68,7 +77,7 @@ func (c *ExchangeChaincode) initAccount() pb.Response {
 	asset, err = c.getOwnerOneAsset(user, USD)
 	if err != nil {
 		myLogger.Errorf("initAccount error3:%s", err)
-		return shim.Error(fmt.Sprintf("Failed retrieving asset [%s] of the user: [%s]", USD, err))
+		return errorResponse(newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", USD, err))
 	}
 	if asset == nil || asset.UUID == "" {
 		err = c.putAsset(&Asset{
@@ -78,7 +87,7 @@ func (c *ExchangeChaincode) initAccount() pb.Response {
 			LockCount: 0,
 		})
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 	}
 
@@ -87,41 +96,96 @@ func (c *ExchangeChaincode) initAccount() pb.Response {
 	return shim.Success(nil)
 }
 
+// CurrencyDefinition is the definition of a currency passed to create
+type CurrencyDefinition struct {
+	Name          string `json:"name"`
+	Count         int64  `json:"count"`
+	DisplayName   string `json:"displayName"`
+	Symbol        string `json:"symbol"`
+	Decimals      int    `json:"decimals"`
+	MaxSupply     int64  `json:"maxSupply"`
+	Description   string `json:"description"`
+	IssuerContact string `json:"issuerContact"`
+}
+
+// maxDecimals is the most decimal places a currency can have
+const maxDecimals = 18
+
 // create create currency
-// args:currency id, currency count, currency creator
+// args: json{name, count, displayName, symbol, decimals, maxSupply, description, issuerContact}, [currency creator] (operator only)
 func (c *ExchangeChaincode) create() pb.Response {
 	myLogger.Debug("Create Currency...")
 
-	if len(c.args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	def := new(CurrencyDefinition)
+	err := json.Unmarshal([]byte(c.args[0]), def)
+	if err != nil {
+		myLogger.Errorf("create error1:%s", err)
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling currency definition: [%s]", err))
 	}
 
-	name := c.args[0]
-	count, _ := strconv.ParseInt(c.args[1], 10, 64)
-	creator := c.args[2]
-	now := time.Now().Unix()
+	creator, err := c.getAccount(1)
+	if err != nil {
+		myLogger.Errorf("create error2:%s", err)
+		return errorResponse(err)
+	}
+	err = c.checkRole(creator, RoleIssuer)
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	err := c.putCurrency(&Currency{
-		Name:       name,
-		Count:      count,
-		LeftCount:  count,
-		Creator:    creator,
-		CreateTime: now,
+	if def.Name == "" {
+		return errorResponse(newError(CodeInvalidArgument, "The currency name can't be empty"))
+	}
+	if def.Count < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The currency count must be >= 0"))
+	}
+	if def.Decimals < 0 || def.Decimals > maxDecimals {
+		return errorResponse(newError(CodeInvalidArgument, "The currency decimals must be between 0 and %d", maxDecimals))
+	}
+	if def.MaxSupply < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The currency max supply must be >= 0"))
+	}
+	if def.MaxSupply > 0 && def.Count > def.MaxSupply {
+		return errorResponse(newError(CodeSupplyCapExceeded, "The currency count [%d] exceeds the max supply [%d]", def.Count, def.MaxSupply).
+			With("currency", def.Name).With("required", def.Count).With("maxSupply", def.MaxSupply))
+	}
+
+	exist, err := c.getCurrencyByName(def.Name)
+	if err != nil {
+		myLogger.Errorf("create error3:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", def.Name, err))
+	}
+	if exist != nil {
+		return errorResponse(newError(CodeCurrencyExists, "The currency [%s] already exists", def.Name).With("currency", def.Name))
+	}
+
+	err = c.putCurrency(&Currency{
+		Name:          def.Name,
+		Count:         def.Count,
+		LeftCount:     def.Count,
+		Creator:       creator,
+		CreateTime:    c.now,
+		DisplayName:   def.DisplayName,
+		Symbol:        def.Symbol,
+		Decimals:      def.Decimals,
+		MaxSupply:     def.MaxSupply,
+		Description:   def.Description,
+		IssuerContact: def.IssuerContact,
 	})
 	if err != nil {
-		myLogger.Errorf("create error2:%s", err)
-		return shim.Error(err.Error())
+		myLogger.Errorf("create error4:%s", err)
+		return errorResponse(err)
 	}
 
-	if count > 0 {
+	if def.Count > 0 {
 		err = c.putReleaseLog(&ReleaseLog{
-			Currency:    name,
+			Currency:    def.Name,
 			Releaser:    creator,
-			Count:       count,
-			ReleaseTime: now,
+			Count:       def.Count,
+			ReleaseTime: c.now,
 		})
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 	}
 
@@ -135,24 +199,32 @@ func (c *ExchangeChaincode) create() pb.Response {
 func (c *ExchangeChaincode) release() pb.Response {
 	myLogger.Debug("Release Currency...")
 
-	if len(c.args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
 	id := c.args[0]
 	count, err := strconv.ParseInt(c.args[1], 10, 64)
 	if err != nil || count <= 0 {
-		return shim.Error("The currency release count must be > 0")
+		return errorResponse(newError(CodeInvalidArgument, "The currency release count must be > 0"))
 	}
 
 	if id == CNY || id == USD {
-		return shim.Error("Currency can't be CNY or USD")
+		return errorResponse(newError(CodeInvalidArgument, "Currency can't be CNY or USD"))
 	}
 
 	curr, err := c.getCurrencyByName(id)
 	if err != nil {
 		myLogger.Errorf("releaseCurrency error1:%s", err)
-		return shim.Error(fmt.Sprintf("Failed retrieving currency [%s]: [%s]", id, err))
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", id, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", id).With("currency", id))
+	}
+	err = c.checkCreator(curr)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if curr.MaxSupply > 0 && curr.Count+count > curr.MaxSupply {
+		return errorResponse(newError(CodeSupplyCapExceeded, "The currency count would exceed the max supply [%d]", curr.MaxSupply).
+			With("currency", id).With("required", curr.Count+count).With("maxSupply", curr.MaxSupply))
 	}
 
 	// update currency data
@@ -161,17 +233,17 @@ func (c *ExchangeChaincode) release() pb.Response {
 	err = c.putCurrency(curr)
 	if err != nil {
 		myLogger.Errorf("releaseCurrency error2:%s", err)
-		return shim.Error(fmt.Sprintf("Failed replacing row [%s]", err))
+		return errorResponse(newError(CodeInternal, "Failed replacing row [%s]", err))
 	}
 
 	err = c.putReleaseLog(&ReleaseLog{
 		Currency:    id,
 		Releaser:    curr.Creator,
 		Count:       count,
-		ReleaseTime: time.Now().Unix(),
+		ReleaseTime: c.now,
 	})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	myLogger.Debug("Release Currency...done")
@@ -179,15 +251,143 @@ func (c *ExchangeChaincode) release() pb.Response {
 	return shim.Success(nil)
 }
 
+// burn destroy unassigned supply of a currency
+// args: currency id, burn count
+func (c *ExchangeChaincode) burn() pb.Response {
+	myLogger.Debug("Burn Currency...")
+
+	id := c.args[0]
+	count, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil || count <= 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The currency burn count must be > 0"))
+	}
+
+	if id == CNY || id == USD {
+		return errorResponse(newError(CodeInvalidArgument, "Currency can't be CNY or USD"))
+	}
+
+	curr, err := c.getCurrencyByName(id)
+	if err != nil {
+		myLogger.Errorf("burnCurrency error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", id, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", id).With("currency", id))
+	}
+	err = c.checkCreator(curr)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if curr.LeftCount < count {
+		return errorResponse(newError(CodeInsufficientSupply, "The left count [%d] of currency [%s] is insufficient", curr.LeftCount, id).
+			With("currency", id).With("required", count).With("available", curr.LeftCount))
+	}
+
+	curr.Count = curr.Count - count
+	curr.LeftCount = curr.LeftCount - count
+	err = c.putCurrency(curr)
+	if err != nil {
+		myLogger.Errorf("burnCurrency error2:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed replacing row [%s]", err))
+	}
+
+	err = c.putBurnLog(&BurnLog{
+		Currency: id,
+		Burner:   curr.Creator,
+		Count:    count,
+		BurnTime: c.now,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Burn Currency...done")
+
+	return shim.Success(nil)
+}
+
+// redeem return assigned currency of the caller to the issuer, reducing the supply
+// args: currency id, redeem count
+func (c *ExchangeChaincode) redeem() pb.Response {
+	myLogger.Debug("Redeem Currency...")
+
+	id := c.args[0]
+	count, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil || count <= 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The currency redeem count must be > 0"))
+	}
+
+	owner, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = c.checkAccountActive(owner)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	curr, err := c.getCurrencyByName(id)
+	if err != nil {
+		myLogger.Errorf("redeemCurrency error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", id, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", id).With("currency", id))
+	}
+	err = curr.allows("be redeemed", (*Currency).canTransfer)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	asset, err := c.getOwnerOneAsset(owner, id)
+	if err != nil {
+		myLogger.Errorf("redeemCurrency error2:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", id, err))
+	}
+	if asset == nil {
+		return errorResponse(newError(CodeAssetNotFound, "The user have not currency [%s]", id).With("owner", owner).With("currency", id))
+	}
+	if asset.Count < count {
+		return errorResponse(newError(CodeInsufficientBalance, "Currency [%s] of the user is insufficient", id).
+			With("currency", id).With("required", count).With("available", asset.Count))
+	}
+
+	asset.Count = asset.Count - count
+	err = c.putAsset(asset)
+	if err != nil {
+		myLogger.Errorf("redeemCurrency error3:%s", err)
+		return errorResponse(err)
+	}
+
+	// the redeemed count leaves the assigned supply, LeftCount is unchanged
+	curr.Count = curr.Count - count
+	err = c.putCurrency(curr)
+	if err != nil {
+		myLogger.Errorf("redeemCurrency error4:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed replacing row [%s]", err))
+	}
+
+	err = c.putRedeemLog(&RedeemLog{
+		Currency:   id,
+		Redeemer:   owner,
+		Count:      count,
+		RedeemTime: c.now,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Redeem Currency...done")
+
+	return shim.Success(nil)
+}
+
 // assign  assign currency
 // args: json{currency id, []{reciver, count}}
 func (c *ExchangeChaincode) assign() pb.Response {
 	myLogger.Debug("Assign Currency...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-
 	assign := struct {
 		Currency string `json:"currency"`
 		Assigns  []struct {
@@ -199,7 +399,7 @@ func (c *ExchangeChaincode) assign() pb.Response {
 	err := json.Unmarshal([]byte(c.args[0]), &assign)
 	if err != nil {
 		myLogger.Errorf("assignCurrency error1:%s", err)
-		return shim.Error(fmt.Sprintf("Failed unmarshalling assign data: [%s]", err))
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling assign data: [%s]", err))
 	}
 
 	if len(assign.Assigns) == 0 {
@@ -209,7 +409,18 @@ func (c *ExchangeChaincode) assign() pb.Response {
 	curr, err := c.getCurrencyByName(assign.Currency)
 	if err != nil {
 		myLogger.Errorf("assignCurrency error2:%s", err)
-		return shim.Error(fmt.Sprintf("Failed retrieving currency [%s]: [%s]", assign.Currency, err))
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", assign.Currency, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", assign.Currency).With("currency", assign.Currency))
+	}
+	err = c.checkCreator(curr)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = curr.allows("be assigned", (*Currency).canAssign)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	assignCount := int64(0)
@@ -218,9 +429,15 @@ func (c *ExchangeChaincode) assign() pb.Response {
 			continue
 		}
 
+		err = c.checkAccountActive(v.Owner)
+		if err != nil {
+			return errorResponse(err)
+		}
+
 		assignCount += v.Count
 		if assignCount > curr.LeftCount {
-			return shim.Error(fmt.Sprintf("The left count [%d] of currency [%s] is insufficient", curr.LeftCount, assign.Currency))
+			return errorResponse(newError(CodeInsufficientSupply, "The left count [%d] of currency [%s] is insufficient", curr.LeftCount, assign.Currency).
+				With("currency", assign.Currency).With("required", assignCount).With("available", curr.LeftCount))
 		}
 	}
 
@@ -234,23 +451,26 @@ func (c *ExchangeChaincode) assign() pb.Response {
 			FromUser:   curr.Creator,
 			ToUser:     v.Owner,
 			Count:      v.Count,
-			AssignTime: time.Now().Unix(),
+			AssignTime: c.now,
 		})
 		if err != nil {
 			myLogger.Errorf("assignCurrency error3:%s", err)
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		asset, err := c.getOwnerOneAsset(v.Owner, assign.Currency)
 		if err != nil {
 			myLogger.Errorf("assignCurrency error4:%s", err)
-			return shim.Error(fmt.Sprintf("Failed retrieving asset [%s] of the user: [%s]", assign.Currency, err))
+			return errorResponse(newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", assign.Currency, err))
 		}
 
+		if asset == nil {
+			asset = &Asset{Owner: v.Owner, Currency: assign.Currency}
+		}
 		asset.Count = asset.Count + v.Count
 		err = c.putAsset(asset)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		curr.LeftCount -= v.Count
@@ -258,33 +478,34 @@ func (c *ExchangeChaincode) assign() pb.Response {
 
 	err = c.putCurrency(curr)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	myLogger.Debug("Assign Currency...done")
 	return shim.Success(nil)
 }
 
-// lock lock or unlock user asset when commit a exchange or cancel exchange
-// args: json []{user, currency id, lock count, lock order}, islock, srcMethod
+// lock lock or unlock user asset when commit a exchange or cancel exchange.
+// A lock records the limit and expiry of its order, which exchange holds the fills to.
+// args: json []{user, currency id, lock count, lock order, desCurrency, desCount, [expiredTime], [ttl]}, islock, srcMethod
 func (c *ExchangeChaincode) lock() pb.Response {
 	myLogger.Debug("Lock Asset Balance...")
 
-	if len(c.args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
-	}
-
 	var lockInfos []struct {
-		Owner    string `json:"owner"`
-		Currency string `json:"currency"`
-		OrderId  string `json:"orderId"`
-		Count    int64  `json:"count"`
+		Owner       string `json:"owner"`
+		Currency    string `json:"currency"`
+		OrderId     string `json:"orderId"`
+		Count       int64  `json:"count"`
+		DesCurrency string `json:"desCurrency"`
+		DesCount    int64  `json:"desCount"`
+		ExpiredTime int64  `json:"expiredTime"`
+		TTL         int64  `json:"ttl"`
 	}
 
 	err := json.Unmarshal([]byte(c.args[0]), &lockInfos)
 	if err != nil {
 		myLogger.Errorf("lock error1:%s", err)
-		return shim.Error(err.Error())
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling lock data: [%s]", err))
 	}
 	islock, _ := strconv.ParseBool(c.args[1])
 
@@ -292,13 +513,38 @@ func (c *ExchangeChaincode) lock() pb.Response {
 	var failInfos []FailInfo
 
 	for _, v := range lockInfos {
-		err, errType := c.lockOrUnlockBalance(v.Owner, v.Currency, v.OrderId, v.Count, islock)
+		if v.TTL < 0 || (v.TTL > 0 && !islock) {
+			failInfos = append(failInfos, newFailInfo(v.OrderId, newError(CodeInvalidArgument, "The ttl must be > 0 and only set on locks").With("orderId", v.OrderId)))
+			continue
+		}
+		expireTime := int64(0)
+		if v.TTL > 0 {
+			expireTime = c.now + v.TTL
+		}
+
+		var limit *OrderLimit
+		if islock {
+			if v.DesCurrency == "" || v.DesCurrency == v.Currency || v.DesCount <= 0 {
+				failInfos = append(failInfos, newFailInfo(v.OrderId, newError(CodeInvalidArgument, "A lock needs the des currency and count of its order").With("orderId", v.OrderId)))
+				continue
+			}
+			if v.ExpiredTime < 0 || (v.ExpiredTime != 0 && v.ExpiredTime <= c.now) {
+				failInfos = append(failInfos, newFailInfo(v.OrderId, newError(CodeInvalidArgument, "The order is already expired").With("orderId", v.OrderId).With("expiredTime", v.ExpiredTime)))
+				continue
+			}
+			limit = &OrderLimit{DesCurrency: v.DesCurrency, DesCount: v.DesCount, ExpiredTime: v.ExpiredTime}
+		} else if v.ExpiredTime != 0 {
+			failInfos = append(failInfos, newFailInfo(v.OrderId, newError(CodeInvalidArgument, "The expired time is only set on locks").With("orderId", v.OrderId)))
+			continue
+		}
+
+		err, errType := c.lockOrUnlockBalance(v.Owner, v.Currency, v.OrderId, v.Count, islock, expireTime, limit)
 		if errType == CheckErr && err != ExecedErr {
-			failInfos = append(failInfos, FailInfo{Id: v.OrderId, Info: err.Error()})
+			failInfos = append(failInfos, newFailInfo(v.OrderId, err))
 			continue
 		} else if errType == WorldStateErr {
 			myLogger.Errorf("lock error2:%s", err)
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 		successInfos = append(successInfos, v.OrderId)
 	}
@@ -307,7 +553,7 @@ func (c *ExchangeChaincode) lock() pb.Response {
 	result, err := json.Marshal(&batch)
 	if err != nil {
 		myLogger.Errorf("lock error3:%s", err)
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	c.stub.SetEvent(batch.EventName, result)
@@ -321,10 +567,6 @@ func (c *ExchangeChaincode) lock() pb.Response {
 func (c *ExchangeChaincode) exchange() pb.Response {
 	myLogger.Debug("Exchange...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-
 	var exchangeOrders []struct {
 		BuyOrder  Order `json:"buyOrder"`
 		SellOrder Order `json:"sellOrder"`
@@ -332,7 +574,7 @@ func (c *ExchangeChaincode) exchange() pb.Response {
 	err := json.Unmarshal([]byte(c.args[0]), &exchangeOrders)
 	if err != nil {
 		myLogger.Errorf("exchange error1:%s", err)
-		return shim.Error("Failed unmarshalling order")
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling order"))
 	}
 
 	var successInfos []string
@@ -343,47 +585,59 @@ func (c *ExchangeChaincode) exchange() pb.Response {
 		sellOrder := v.SellOrder
 		matchOrder := buyOrder.UUID + "," + sellOrder.UUID
 
-		if buyOrder.SrcCurrency != sellOrder.DesCurrency ||
-			buyOrder.DesCurrency != sellOrder.SrcCurrency {
-			return shim.Error("The exchange is invalid")
-		}
-
 		// check exchanged or not
-		buy, err := c.getTxLog(buyOrder.UUID)
+		settled, err := c.isSettled(buyOrder.UUID)
 		if err != nil {
 			myLogger.Errorf("exchange error2:%s", err)
-			failInfos = append(failInfos, FailInfo{Id: matchOrder, Info: err.Error()})
+			failInfos = append(failInfos, newFailInfo(matchOrder, err))
 			continue
 		}
-		if buy != nil && buy.UUID != "" {
-			// exchanged
+		if !settled {
+			settled, err = c.isSettled(sellOrder.UUID)
+			if err != nil {
+				myLogger.Errorf("exchange error3:%s", err)
+				failInfos = append(failInfos, newFailInfo(matchOrder, err))
+				continue
+			}
+		}
+		if settled {
+			failInfos = append(failInfos, newFailInfo(matchOrder, newError(CodeAlreadyExecuted, "The exchange [%s] is already executed", matchOrder).
+				With("buyOrder", buyOrder.UUID).With("sellOrder", sellOrder.UUID)))
+			continue
 		}
 
-		sell, err := c.getTxLog(sellOrder.UUID)
+		// check the fills against each other and the original orders
+		err = c.checkExchange(&buyOrder, &sellOrder)
 		if err != nil {
-			myLogger.Errorf("exchange error3:%s", err)
-			failInfos = append(failInfos, FailInfo{Id: matchOrder, Info: err.Error()})
+			failInfos = append(failInfos, newFailInfo(matchOrder, err))
 			continue
 		}
-		if sell != nil && sell.UUID != "" {
-			// exchanged
+
+		// check the KYC tier limits of both accounts
+		err = c.checkTradeLimits(&buyOrder)
+		if err == nil {
+			err = c.checkTradeLimits(&sellOrder)
+		}
+		if err != nil {
+			failInfos = append(failInfos, newFailInfo(matchOrder, err))
+			continue
 		}
 
 		// execTx
 		err, errType := c.execTx(&buyOrder, &sellOrder)
 		if errType == CheckErr && err != ExecedErr {
-			failInfos = append(failInfos, FailInfo{Id: matchOrder, Info: err.Error()})
+			failInfos = append(failInfos, newFailInfo(matchOrder, err))
 			continue
 		} else if errType == WorldStateErr {
 			myLogger.Errorf("exchange error4:%s", err)
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		// txlog
 		err = c.putTxLog(&buyOrder, &sellOrder)
 		if err != nil {
 			myLogger.Errorf("exchange error5:%s", err)
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		successInfos = append(successInfos, matchOrder)
@@ -393,7 +647,7 @@ func (c *ExchangeChaincode) exchange() pb.Response {
 	result, err := json.Marshal(&batch)
 	if err != nil {
 		myLogger.Errorf("exchange error6:%s", err)
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	c.stub.SetEvent(batch.EventName, result)
 
@@ -401,127 +655,274 @@ func (c *ExchangeChaincode) exchange() pb.Response {
 	return shim.Success(nil)
 }
 
+// checkExchange checks that the two sides of a matched pair agree with each other
+// and that neither side trades beyond its original order
+func (c *ExchangeChaincode) checkExchange(buyOrder, sellOrder *Order) error {
+	if buyOrder.UUID == sellOrder.UUID || (buyOrder.RawUUID != "" && buyOrder.RawUUID == sellOrder.RawUUID) {
+		return newError(CodeInvalidExchange, "The buy and sell orders must be different orders").
+			With("buyOrder", buyOrder.RawUUID).With("sellOrder", sellOrder.RawUUID)
+	}
+	if buyOrder.SrcCurrency != sellOrder.DesCurrency ||
+		buyOrder.DesCurrency != sellOrder.SrcCurrency {
+		return newError(CodeInvalidExchange, "The currencies of the orders don't match").
+			With("buyCurrencies", buyOrder.SrcCurrency+"/"+buyOrder.DesCurrency).
+			With("sellCurrencies", sellOrder.SrcCurrency+"/"+sellOrder.DesCurrency)
+	}
+
+	if buyOrder.DesCount != sellOrder.FinalCost {
+		return newError(CodeInvalidExchange, "The buy order receives [%d] but the sell order pays [%d]", buyOrder.DesCount, sellOrder.FinalCost).
+			With("currency", buyOrder.DesCurrency).With("required", buyOrder.DesCount).With("actual", sellOrder.FinalCost)
+	}
+	if sellOrder.DesCount != buyOrder.FinalCost {
+		return newError(CodeInvalidExchange, "The sell order receives [%d] but the buy order pays [%d]", sellOrder.DesCount, buyOrder.FinalCost).
+			With("currency", sellOrder.DesCurrency).With("required", sellOrder.DesCount).With("actual", buyOrder.FinalCost)
+	}
+
+	for _, name := range []string{buyOrder.SrcCurrency, buyOrder.DesCurrency} {
+		err := c.checkCurrencyAllows(name, "be exchanged", (*Currency).canTrade)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.checkFill(buyOrder, "buy")
+	if err != nil {
+		return err
+	}
+	return c.checkFill(sellOrder, "sell")
+}
+
+// checkFill checks one side of an exchange against the lock of its raw order. The
+// fill may not pay more FinalCost per DesCount than the limit stored with the lock,
+// and the fills of a RawUUID may not cost more than was locked for it.
+func (c *ExchangeChaincode) checkFill(order *Order, side string) error {
+	if order.FinalCost <= 0 || order.DesCount <= 0 {
+		return newError(CodeInvalidExchange, "The %s order counts must be > 0", side).
+			With("side", side).With("orderId", order.UUID)
+	}
+	if order.RawUUID == "" {
+		return newError(CodeInvalidExchange, "The %s order has no raw order", side).
+			With("side", side).With("orderId", order.UUID)
+	}
+
+	book, err := c.getOrder(order.RawUUID)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving order [%s]: [%s]", order.RawUUID, err)
+	}
+	if book != nil && book.Status != "" {
+		return newError(CodeInvalidExchange, "The %s order [%s] is on the order book and is settled by match", side, order.RawUUID).
+			With("side", side).With("orderId", order.RawUUID)
+	}
+
+	lockLog, err := c.getLockLogByParm(order.Account, order.SrcCurrency, order.RawUUID, true)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving lock of order [%s]: [%s]", order.RawUUID, err)
+	}
+	if lockLog == nil {
+		return newError(CodeLockNotFound, "The %s order [%s] is not locked", side, order.RawUUID).
+			With("side", side).With("orderId", order.RawUUID)
+	}
+	unlockLog, err := c.getLockLogByParm(order.Account, order.SrcCurrency, order.RawUUID, false)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving unlock of order [%s]: [%s]", order.RawUUID, err)
+	}
+	if unlockLog != nil {
+		return newError(CodeLockNotFound, "The %s order [%s] is unlocked", side, order.RawUUID).
+			With("side", side).With("orderId", order.RawUUID).With("unlocked", unlockLog.LockCount)
+	}
+	if lockLog.isExpired(c.now) {
+		return newError(CodeLockExpired, "The lock of %s order [%s] expired at [%d]", side, order.RawUUID, lockLog.ExpireTime).
+			With("side", side).With("orderId", order.RawUUID).With("expireTime", lockLog.ExpireTime)
+	}
+	if lockLog.isOrderExpired(c.now) {
+		return newError(CodeOrderExpired, "The %s order [%s] expired at [%d]", side, order.RawUUID, lockLog.ExpiredTime).
+			With("side", side).With("orderId", order.RawUUID).With("expiredTime", lockLog.ExpiredTime)
+	}
+
+	if lockLog.OrderLimit == nil {
+		return newError(CodeInvalidExchange, "The lock of %s order [%s] has no limit", side, order.RawUUID).
+			With("side", side).With("orderId", order.RawUUID)
+	}
+	if order.DesCurrency != lockLog.DesCurrency {
+		return newError(CodeInvalidExchange, "The %s order [%s] is locked for [%s], not [%s]", side, order.RawUUID, lockLog.DesCurrency, order.DesCurrency).
+			With("side", side).With("orderId", order.RawUUID).With("currency", order.DesCurrency)
+	}
+	if !mulGTE(order.DesCount, lockLog.LockCount, order.FinalCost, lockLog.DesCount) {
+		return newError(CodePriceLimit, "The %s order pays [%d] for [%d] but its limit is [%d] for [%d]", side, order.FinalCost, order.DesCount, lockLog.LockCount, lockLog.DesCount).
+			With("side", side).With("orderId", order.RawUUID).With("limitSrcCount", lockLog.LockCount).With("limitDesCount", lockLog.DesCount).
+			With("srcCount", order.FinalCost).With("desCount", order.DesCount)
+	}
+
+	txs, err := c.getTXs(order.Account, order.SrcCurrency, order.DesCurrency, order.RawUUID)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving fills of order [%s]: [%s]", order.RawUUID, err)
+	}
+	filled := int64(0)
+	for _, tx := range txs {
+		filled += tx.FinalCost
+	}
+	if filled+order.FinalCost > lockLog.LockCount {
+		return newError(CodeOverfilled, "The fills of %s order [%s] exceed its size", side, order.RawUUID).
+			With("side", side).With("orderId", order.RawUUID).With("size", lockLog.LockCount).
+			With("filled", filled).With("required", order.FinalCost)
+	}
+
+	return nil
+}
+
 // execTx execTx
 func (c *ExchangeChaincode) execTx(buyOrder, sellOrder *Order) (error, ErrType) {
-	// UUID=rawuuID
-	if buyOrder.IsBuyAll && buyOrder.UUID == buyOrder.RawUUID {
-		unlock, err := c.computeBalance(buyOrder.Account, buyOrder.SrcCurrency, buyOrder.DesCurrency, buyOrder.RawUUID, buyOrder.FinalCost)
+	// frozen or closed accounts can't trade
+	for _, owner := range []string{buyOrder.Account, sellOrder.Account} {
+		err := c.checkAccountActive(owner)
 		if err != nil {
-			myLogger.Errorf("execTx error1:%s", err)
-			return errors.New("Failed compute balance"), CheckErr
-		}
-		myLogger.Debugf("Order %s balance %d", buyOrder.UUID, unlock)
-		if unlock > 0 {
-			err, errType := c.lockOrUnlockBalance(buyOrder.Account, buyOrder.SrcCurrency, buyOrder.RawUUID, unlock, false)
-			if err != nil {
-				myLogger.Errorf("execTx error2:%s", err)
-				return errors.New("Failed unlock balance"), errType
-			}
+			return err, CheckErr
 		}
 	}
 
-	// buy order srcCurrency -
-	buySrcAsset, err := c.getOwnerOneAsset(buyOrder.Account, buyOrder.SrcCurrency)
+	// fees are taken from the count each side receives
+	err := c.computeFee(buyOrder, sellOrder)
 	if err != nil {
-		myLogger.Errorf("execTx error3:%s", err)
-		return fmt.Errorf("Failed retrieving asset [%s] of the user: [%s]", buyOrder.SrcCurrency, err), CheckErr
+		myLogger.Errorf("execTx error1:%s", err)
+		return newError(CodeInternal, "Failed computing fee: [%s]", err), WorldStateErr
+	}
+	err = c.computeFee(sellOrder, buyOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error2:%s", err)
+		return newError(CodeInternal, "Failed computing fee: [%s]", err), WorldStateErr
+	}
+
+	// check both sides before writing, an error after the first write fails the tx
+	err = c.checkFeeCollector(buyOrder, sellOrder)
+	if err != nil {
+		return err, CheckErr
+	}
+	buyUnlock, err := c.checkTxSide(buyOrder)
+	if err != nil {
+		return err, CheckErr
+	}
+	sellUnlock, err := c.checkTxSide(sellOrder)
+	if err != nil {
+		return err, CheckErr
 	}
-	if buySrcAsset == nil || buySrcAsset.UUID == "" {
-		return fmt.Errorf("The user have not currency [%s]", buyOrder.SrcCurrency), CheckErr
+
+	err = c.settleTxSide(buyOrder, buyUnlock)
+	if err != nil {
+		myLogger.Errorf("execTx error3:%s", err)
+		return err, WorldStateErr
 	}
-	buySrcAsset.LockCount = buySrcAsset.LockCount - buyOrder.FinalCost
-	err = c.putAsset(buySrcAsset)
+	err = c.settleTxSide(sellOrder, sellUnlock)
 	if err != nil {
 		myLogger.Errorf("execTx error4:%s", err)
-		return errors.New("Failed updating row"), WorldStateErr
+		return err, WorldStateErr
 	}
 
-	// buy order srcCurrency +
-	buyDesAsset, err := c.getOwnerOneAsset(buyOrder.Account, buyOrder.DesCurrency)
+	// daily volume +
+	err = c.addTradeVolume(buyOrder)
 	if err != nil {
 		myLogger.Errorf("execTx error5:%s", err)
-		return fmt.Errorf("Failed retrieving asset [%s] of the user: [%s]", buyOrder.DesCurrency, err), CheckErr
+		return newError(CodeInternal, "Failed updating volume"), WorldStateErr
+	}
+	err = c.addTradeVolume(sellOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error6:%s", err)
+		return newError(CodeInternal, "Failed updating volume"), WorldStateErr
 	}
-	if buyDesAsset == nil || buyDesAsset.UUID == "" {
-		err = c.putAsset(&Asset{
-			Owner:     buyOrder.Account,
-			Currency:  buyOrder.DesCurrency,
-			Count:     buyOrder.DesCount,
-			LockCount: int64(0),
-		})
 
+	// fee collector +
+	err = c.creditFee(buyOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error7:%s", err)
+		return newError(CodeInternal, "Failed crediting fee"), WorldStateErr
+	}
+	err = c.creditFee(sellOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error8:%s", err)
+		return newError(CodeInternal, "Failed crediting fee"), WorldStateErr
+	}
+
+	// trade totals +
+	err = c.addTradeSum(buyOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error9:%s", err)
+		return newError(CodeInternal, "Failed updating trade totals"), WorldStateErr
+	}
+	err = c.addTradeSum(sellOrder)
+	if err != nil {
+		myLogger.Errorf("execTx error10:%s", err)
+		return newError(CodeInternal, "Failed updating trade totals"), WorldStateErr
+	}
+	return nil, ErrType("")
+}
+
+// checkTxSide checks that one side of an execTx can be settled without writing
+// anything. It returns the balance to unlock when the fill completes a buy-all order.
+func (c *ExchangeChaincode) checkTxSide(order *Order) (int64, error) {
+	unlock := int64(0)
+	// UUID=rawuuID
+	if order.IsBuyAll && order.UUID == order.RawUUID {
+		var err error
+		unlock, err = c.computeBalance(order.Account, order.SrcCurrency, order.DesCurrency, order.RawUUID, order.FinalCost)
 		if err != nil {
-			myLogger.Errorf("execTx error6:%s", err)
-			return errors.New("Failed inserting row"), WorldStateErr
-		}
-	} else {
-		buyDesAsset.Count = buyDesAsset.Count + buyOrder.DesCount
-		err = c.putAsset(buyDesAsset)
-		if err != nil {
-			myLogger.Errorf("execTx error7:%s", err)
-			return errors.New("Failed updating row"), WorldStateErr
+			myLogger.Errorf("checkTxSide error1:%s", err)
+			return 0, newError(toCodeError(err).Code, "Failed compute balance").With("orderId", order.RawUUID)
 		}
+		myLogger.Debugf("Order %s balance %d", order.UUID, unlock)
+	}
+
+	asset, err := c.getOwnerOneAsset(order.Account, order.SrcCurrency)
+	if err != nil {
+		myLogger.Errorf("checkTxSide error2:%s", err)
+		return 0, newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", order.SrcCurrency, err)
+	}
+	if asset == nil || asset.UUID == "" {
+		return 0, newError(CodeAssetNotFound, "The user have not currency [%s]", order.SrcCurrency).
+			With("owner", order.Account).With("currency", order.SrcCurrency)
+	}
+	if asset.LockCount < order.FinalCost+unlock {
+		return 0, newError(CodeInsufficientLocked, "Locked currency [%s] of the user is insufficient", order.SrcCurrency).
+			With("orderId", order.RawUUID).With("currency", order.SrcCurrency).
+			With("required", order.FinalCost+unlock).With("available", asset.LockCount)
 	}
 
-	// UUID=rawuuid
-	if sellOrder.IsBuyAll && sellOrder.UUID == sellOrder.RawUUID {
-		unlock, err := c.computeBalance(sellOrder.Account, sellOrder.SrcCurrency, sellOrder.DesCurrency, sellOrder.RawUUID, sellOrder.FinalCost)
+	return unlock, nil
+}
+
+// settleTxSide moves the FinalCost of one side out of its locked balance and credits
+// its DesCount less the fee, after unlocking the rest of a completed buy-all order
+func (c *ExchangeChaincode) settleTxSide(order *Order, unlock int64) error {
+	if unlock > 0 {
+		err, _ := c.lockOrUnlockBalance(order.Account, order.SrcCurrency, order.RawUUID, unlock, false, 0, nil)
 		if err != nil {
-			myLogger.Errorf("execTx error8:%s", err)
-			return errors.New("Failed compute balance"), CheckErr
-		}
-		myLogger.Debugf("Order %s balance %d", sellOrder.UUID, unlock)
-		if unlock > 0 {
-			err, errType := c.lockOrUnlockBalance(sellOrder.Account, sellOrder.SrcCurrency, sellOrder.RawUUID, unlock, false)
-			if err != nil {
-				myLogger.Errorf("execTx error9:%s", err)
-				return errors.New("Failed unlock balance"), errType
-			}
+			return newError(CodeInternal, "Failed unlock balance: [%s]", err).With("orderId", order.RawUUID)
 		}
 	}
 
-	// sell order srcCurrency -
-	sellSrcAsset, err := c.getOwnerOneAsset(sellOrder.Account, sellOrder.SrcCurrency)
+	// srcCurrency -
+	srcAsset, err := c.getOwnerOneAsset(order.Account, order.SrcCurrency)
 	if err != nil {
-		myLogger.Errorf("execTx error10:%s", err)
-		return fmt.Errorf("Failed retrieving asset [%s] of the user: [%s]", sellOrder.SrcCurrency, err), CheckErr
-	}
-	if sellSrcAsset == nil || sellSrcAsset.UUID == "" {
-		return fmt.Errorf("The user have not currency [%s]", sellOrder.SrcCurrency), CheckErr
+		return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", order.SrcCurrency, err)
 	}
-	sellSrcAsset.LockCount = sellSrcAsset.LockCount - sellOrder.FinalCost
-	err = c.putAsset(sellSrcAsset)
+	srcAsset.LockCount = srcAsset.LockCount - order.FinalCost
+	err = c.putAsset(srcAsset)
 	if err != nil {
-		myLogger.Errorf("execTx error11:%s", err)
-		return errors.New("Failed updating row"), WorldStateErr
+		return newError(CodeInternal, "Failed updating row")
 	}
 
-	// sell order desCurrency +
-	sellDesAsset, err := c.getOwnerOneAsset(sellOrder.Account, sellOrder.DesCurrency)
+	// desCurrency +
+	desAsset, err := c.getOwnerOneAsset(order.Account, order.DesCurrency)
 	if err != nil {
-		myLogger.Errorf("execTx error12:%s", err)
-		return fmt.Errorf("Failed retrieving asset [%s] of the user: [%s]", sellOrder.DesCurrency, err), CheckErr
+		return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", order.DesCurrency, err)
 	}
-	if sellDesAsset == nil || sellDesAsset.UUID == "" {
-		err = c.putAsset(&Asset{
-			Owner:     sellOrder.Account,
-			Currency:  sellOrder.DesCurrency,
-			Count:     sellOrder.DesCount,
-			LockCount: int64(0),
-		})
-		if err != nil {
-			myLogger.Errorf("execTx error13:%s", err)
-			return errors.New("Failed inserting row"), WorldStateErr
-		}
-	} else {
-		sellDesAsset.Count = sellDesAsset.Count + sellOrder.DesCount
-		err = c.putAsset(sellDesAsset)
-		if err != nil {
-			myLogger.Errorf("execTx error14:%s", err)
-			return errors.New("Failed updating row"), WorldStateErr
-		}
+	if desAsset == nil || desAsset.UUID == "" {
+		desAsset = &Asset{Owner: order.Account, Currency: order.DesCurrency}
 	}
-	return nil, ErrType("")
+	desAsset.Count = desAsset.Count + order.DesCount - order.Fee
+	err = c.putAsset(desAsset)
+	if err != nil {
+		return newError(CodeInternal, "Failed updating row")
+	}
+	return nil
 }
 
 // computeBalance
@@ -535,7 +936,7 @@ func (c *ExchangeChaincode) computeBalance(owner string, srcCurrency, desCurrenc
 		return 0, err
 	}
 	if lockLog == nil || lockLog.UUID == "" {
-		return 0, errors.New("can't find lock log")
+		return 0, newError(CodeLockNotFound, "can't find lock log").With("orderId", rawUUID)
 	}
 
 	lock := lockLog.LockCount
@@ -548,18 +949,38 @@ func (c *ExchangeChaincode) computeBalance(owner string, srcCurrency, desCurrenc
 }
 
 // lockOrUnlockBalance lockOrUnlockBalance
-func (c *ExchangeChaincode) lockOrUnlockBalance(owner string, currency, order string, count int64, islock bool) (error, ErrType) {
+// A lock with an expireTime can be released by anyone after it, see releaseExpiredLocks.
+// The limit of the order is stored with a lock, unlocks pass nil.
+func (c *ExchangeChaincode) lockOrUnlockBalance(owner string, currency, order string, count int64, islock bool, expireTime int64, limit *OrderLimit) (error, ErrType) {
+	if islock {
+		err := c.checkAccountActive(owner)
+		if err != nil {
+			return err, CheckErr
+		}
+		err = c.checkCurrencyAllows(currency, "be locked", (*Currency).canTrade)
+		if err != nil {
+			return err, CheckErr
+		}
+		err = c.checkLockLimit(owner, currency, count)
+		if err != nil {
+			return err, CheckErr
+		}
+	}
+
 	asset, err := c.getOwnerOneAsset(owner, currency)
 	if err != nil {
-		return fmt.Errorf("Failed retrieving asset [%s] of the user: [%s]", currency, err), CheckErr
+		return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", currency, err), CheckErr
 	}
 	if asset == nil || asset.UUID == "" {
-		return fmt.Errorf("The user have not currency [%s]", currency), CheckErr
+		return newError(CodeAssetNotFound, "The user have not currency [%s]", currency).
+			With("owner", owner).With("currency", currency), CheckErr
 	}
 	if islock && asset.Count < count {
-		return fmt.Errorf("Currency [%s] of the user is insufficient", currency), CheckErr
+		return newError(CodeInsufficientBalance, "Currency [%s] of the user is insufficient", currency).
+			With("orderId", order).With("currency", currency).With("required", count).With("available", asset.Count), CheckErr
 	} else if !islock && asset.LockCount < count {
-		return fmt.Errorf("Locked currency [%s] of the user is insufficient", currency), CheckErr
+		return newError(CodeInsufficientLocked, "Locked currency [%s] of the user is insufficient", currency).
+			With("orderId", order).With("currency", currency).With("required", count).With("available", asset.LockCount), CheckErr
 	}
 
 	// check the order is locked/unlocked or not
@@ -586,16 +1007,31 @@ func (c *ExchangeChaincode) lockOrUnlockBalance(owner string, currency, order st
 	}
 
 	err = c.putLockLog(&LockLog{
-		Owner:     owner,
-		Currency:  currency,
-		Order:     order,
-		IsLock:    islock,
-		LockCount: count,
-		LockTime:  time.Now().Unix(),
+		Owner:      owner,
+		Currency:   currency,
+		Order:      order,
+		IsLock:     islock,
+		LockCount:  count,
+		LockTime:   c.now,
+		ExpireTime: expireTime,
+		OrderLimit: limit,
 	})
 	if err != nil {
 		return err, WorldStateErr
 	}
 
+	if !islock {
+		lockLog, err = c.getLockLogByParm(owner, currency, order, true)
+		if err != nil {
+			return err, WorldStateErr
+		}
+		if lockLog != nil {
+			err = c.delLockExpiry(lockLog)
+			if err != nil {
+				return err, WorldStateErr
+			}
+		}
+	}
+
 	return nil, ErrType("")
 }
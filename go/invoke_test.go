@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// lockFor locks the source of an order placed off chain
+func (e *testEnv) lockFor(who, orderID, src string, srcCount int64, des string, desCount int64) {
+	e.t.Helper()
+	e.mustInvoke("op", "lock", fmt.Sprintf(`[{"owner":"%s","currency":"%s","orderId":"%s","count":%d,"desCurrency":"%s","desCount":%d}]`,
+		e.acct(who), src, orderID, srcCount, des, desCount), "true", "test")
+	var batch BatchResult
+	e.event("chaincode_lock", &batch)
+	if len(batch.Fail) > 0 {
+		e.t.Fatalf("lock %s failed: %+v", orderID, batch.Fail)
+	}
+}
+
+// fill is one side of an exchange pair, src is the srcCount claimed for it
+type fill struct {
+	who, uuid, raw string
+	cost, des, src int64
+}
+
+// pairJSON returns an exchange pair selling BTC for ETH (sell side) against ETH for BTC (buy side)
+func (e *testEnv) pairJSON(buy, sell fill) string {
+	side := func(f fill, src, des string) string {
+		if f.src == 0 {
+			f.src = f.cost
+		}
+		return fmt.Sprintf(`{"uuid":"%s","rawUUID":"%s","account":"%s","srcCurrency":"%s","desCurrency":"%s","srcCount":%d,"finalCost":%d,"desCount":%d}`,
+			f.uuid, f.raw, e.acct(f.who), src, des, f.src, f.cost, f.des)
+	}
+	return fmt.Sprintf(`{"buyOrder":%s,"sellOrder":%s}`, side(buy, "ETH", "BTC"), side(sell, "BTC", "ETH"))
+}
+
+// exchange settles the pairs and returns the batch result
+func (e *testEnv) exchange(pairs ...string) BatchResult {
+	e.t.Helper()
+	args := "["
+	for i, p := range pairs {
+		if i > 0 {
+			args += ","
+		}
+		args += p
+	}
+	e.mustInvoke("op", "exchange", args+"]")
+	var batch BatchResult
+	e.event("chaincode_exchange", &batch)
+	return batch
+}
+
+// checkBatch fails the test unless the batch has the successes and the failure codes, in order
+func checkBatch(t *testing.T, batch BatchResult, success int, codes ...ErrCode) {
+	t.Helper()
+	if len(batch.Success) != success || len(batch.Fail) != len(codes) {
+		t.Fatalf("batch has %d successes and fails %+v, expected %d and %v", len(batch.Success), batch.Fail, success, codes)
+	}
+	for i, code := range codes {
+		if batch.Fail[i].Code != code {
+			t.Fatalf("fail %d is %s (%s), expected %s", i, batch.Fail[i].Code, batch.Fail[i].Info, code)
+		}
+	}
+}
+
+// newExchangeEnv funds alice with BTC and bob with ETH and locks an order for each:
+// alice sells 10 BTC for at least 20 ETH, bob sells 40 ETH for at least 20 BTC
+func newExchangeEnv(t *testing.T) *testEnv {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+	e.lockFor("alice", "A1", "BTC", 10, "ETH", 20)
+	e.lockFor("bob", "B1", "ETH", 40, "BTC", 20)
+	return e
+}
+
+func TestExchangeSettlesWithinLimits(t *testing.T) {
+	e := newExchangeEnv(t)
+
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 20, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}))
+	checkBatch(t, batch, 1)
+
+	e.checkBalance("alice", "BTC", 90, 0)
+	e.checkBalance("alice", "ETH", 20, 0)
+	e.checkBalance("bob", "ETH", 60, 20)
+	e.checkBalance("bob", "BTC", 10, 0)
+}
+
+func TestExchangeRejectsFillsWorseThanTheLockedLimit(t *testing.T) {
+	e := newExchangeEnv(t)
+
+	// alice would get 19 ETH for 10 BTC, below her limit of 2 ETH per BTC
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 19, 10, 0}, fill{"alice", "A1-1", "A1", 10, 19, 0}))
+	checkBatch(t, batch, 0, CodePriceLimit)
+
+	// the srcCount in the payload does not widen the limit
+	batch = e.exchange(e.pairJSON(fill{"bob", "B1-2", "B1", 19, 10, 1000}, fill{"alice", "A1-2", "A1", 10, 19, 1000}))
+	checkBatch(t, batch, 0, CodePriceLimit)
+
+	e.checkBalance("alice", "BTC", 90, 10)
+	e.checkBalance("bob", "ETH", 60, 40)
+}
+
+func TestExchangeRejectsLegsThatDisagree(t *testing.T) {
+	e := newExchangeEnv(t)
+
+	batch := e.exchange(
+		e.pairJSON(fill{"bob", "B1-1", "B1", 21, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}),
+		e.pairJSON(fill{"alice", "A1-2", "A1", 20, 10, 0}, fill{"alice", "A1-3", "A1", 10, 20, 0}),
+	)
+	checkBatch(t, batch, 0, CodeInvalidExchange, CodeInvalidExchange)
+}
+
+func TestExchangeRejectsOverfills(t *testing.T) {
+	e := newExchangeEnv(t)
+
+	batch := e.exchange(
+		e.pairJSON(fill{"bob", "B1-1", "B1", 12, 6, 0}, fill{"alice", "A1-1", "A1", 6, 12, 0}),
+		e.pairJSON(fill{"bob", "B1-2", "B1", 12, 6, 0}, fill{"alice", "A1-2", "A1", 6, 12, 0}),
+	)
+	checkBatch(t, batch, 1, CodeOverfilled)
+	e.checkBalance("alice", "BTC", 90, 4)
+}
+
+func TestExchangeRejectsUnlockedOrders(t *testing.T) {
+	e := newExchangeEnv(t)
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A1","count":10}]`, "false", "test")
+	e.checkBalance("alice", "BTC", 100, 0)
+
+	// bob's lock must not pay for alice's side
+	e.lockFor("alice", "A2", "BTC", 10, "ETH", 20)
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 20, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}))
+	checkBatch(t, batch, 0, CodeLockNotFound)
+	e.checkBalance("alice", "BTC", 90, 10)
+	e.checkBalance("alice", "ETH", 0, 0)
+}
+
+func TestLockNeedsTheOrderLimit(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A1","count":10}]`, "true", "test")
+	var batch BatchResult
+	e.event("chaincode_lock", &batch)
+	checkBatch(t, batch, 0, CodeInvalidArgument)
+	e.checkBalance("alice", "BTC", 100, 0)
+}
+
+func TestExchangeReplayIsRejected(t *testing.T) {
+	e := newExchangeEnv(t)
+	pair := e.pairJSON(fill{"bob", "B1-1", "B1", 10, 5, 0}, fill{"alice", "A1-1", "A1", 5, 10, 0})
+
+	checkBatch(t, e.exchange(pair), 1)
+	checkBatch(t, e.exchange(pair), 0, CodeAlreadyExecuted)
+
+	e.checkBalance("alice", "BTC", 90, 5)
+	e.checkBalance("alice", "ETH", 10, 0)
+	e.checkBalance("bob", "BTC", 5, 0)
+
+	for id, expected := range map[string]string{"A1": StatusPartial, "A1-1": StatusSettled, "A2": StatusUntouched} {
+		status := new(OrderStatus)
+		mustUnmarshal(t, e.mustInvoke("alice", "queryOrderStatus", id), status)
+		if status.Status != expected {
+			t.Fatalf("order %s is %s, expected %s", id, status.Status, expected)
+		}
+	}
+}
+
+func TestExchangeWritesNeitherSideWhenOneFails(t *testing.T) {
+	e := newExchangeEnv(t)
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+
+	// an unlock of another order leaves alice 5 BTC locked for A1
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"X1","count":5}]`, "false", "test")
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 20, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}))
+	checkBatch(t, batch, 0, CodeInsufficientLocked)
+
+	e.checkBalance("bob", "ETH", 60, 40)
+	e.checkBalance("bob", "BTC", 0, 0)
+	e.checkBalance("alice", "BTC", 95, 5)
+	e.checkBalance("alice", "ETH", 0, 0)
+
+	report := new(SupplyReport)
+	mustUnmarshal(t, e.mustInvoke("aud", "auditSupply"), report)
+	if !report.Balanced {
+		t.Fatalf("The supply is not balanced: %+v", report)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// TierLimit is what accounts of a KYC tier can do with a currency, 0 is no limit
+type TierLimit struct {
+	Currency       string `json:"currency"`
+	Tier           int    `json:"tier"`
+	MaxTrade       int64  `json:"maxTrade"`
+	MaxDailyVolume int64  `json:"maxDailyVolume"`
+	MaxHolding     int64  `json:"maxHolding"`
+}
+
+// dayMillis is the length of the daily volume window
+const dayMillis = 24 * 60 * 60 * 1000
+
+// limitError is returned when an account goes over a limit of its tier
+func limitError(limit *TierLimit, owner, name string, max, required int64) error {
+	return newError(CodeLimitExceeded, "The %s of tier [%d] for currency [%s] is [%d]", name, limit.Tier, limit.Currency, max).
+		With("account", owner).With("currency", limit.Currency).With("tier", limit.Tier).
+		With("limit", name).With("max", max).With("required", required)
+}
+
+// getAccountLimit returns the limit of the account's tier for a currency, nil when none is set
+func (c *ExchangeChaincode) getAccountLimit(owner, currency string) (*TierLimit, error) {
+	info, err := c.getAccountInfo(owner)
+	if err != nil {
+		return nil, err
+	}
+	return c.getTierLimit(currency, info.Tier)
+}
+
+// checkLockLimit checks a lock against the max single trade of the owner's tier
+func (c *ExchangeChaincode) checkLockLimit(owner, currency string, count int64) error {
+	limit, err := c.getAccountLimit(owner, currency)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving limit of [%s]: [%s]", owner, err)
+	}
+	if limit != nil && limit.MaxTrade > 0 && count > limit.MaxTrade {
+		return limitError(limit, owner, "maxTrade", limit.MaxTrade, count)
+	}
+	return nil
+}
+
+// checkTradeLimits checks one side of an exchange against the limits of the account's tier
+// for the currency it pays and the currency it receives
+func (c *ExchangeChaincode) checkTradeLimits(order *Order) error {
+	legs := []struct {
+		currency string
+		count    int64
+		receive  bool
+	}{
+		{order.SrcCurrency, order.FinalCost, false},
+		{order.DesCurrency, order.DesCount, true},
+	}
+
+	for _, leg := range legs {
+		limit, err := c.getAccountLimit(order.Account, leg.currency)
+		if err != nil {
+			return newError(CodeInternal, "Failed retrieving limit of [%s]: [%s]", order.Account, err)
+		}
+		if limit == nil {
+			continue
+		}
+
+		if limit.MaxTrade > 0 && leg.count > limit.MaxTrade {
+			return limitError(limit, order.Account, "maxTrade", limit.MaxTrade, leg.count)
+		}
+
+		if limit.MaxDailyVolume > 0 {
+			volume, err := c.getDailyVolume(order.Account, leg.currency, c.now/dayMillis)
+			if err != nil {
+				return newError(CodeInternal, "Failed retrieving volume of [%s]: [%s]", order.Account, err)
+			}
+			if volume+leg.count > limit.MaxDailyVolume {
+				return limitError(limit, order.Account, "maxDailyVolume", limit.MaxDailyVolume, volume+leg.count)
+			}
+		}
+
+		if leg.receive && limit.MaxHolding > 0 {
+			asset, err := c.getOwnerOneAsset(order.Account, leg.currency)
+			if err != nil {
+				return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", leg.currency, err)
+			}
+			holding := leg.count
+			if asset != nil {
+				holding += asset.Count + asset.LockCount
+			}
+			if holding > limit.MaxHolding {
+				return limitError(limit, order.Account, "maxHolding", limit.MaxHolding, holding)
+			}
+		}
+	}
+
+	return nil
+}
+
+// addTradeVolume adds a settled side of an exchange to the daily volume of the account
+func (c *ExchangeChaincode) addTradeVolume(order *Order) error {
+	day := c.now / dayMillis
+	for _, leg := range []struct {
+		currency string
+		count    int64
+	}{{order.SrcCurrency, order.FinalCost}, {order.DesCurrency, order.DesCount}} {
+		volume, err := c.getDailyVolume(order.Account, leg.currency, day)
+		if err != nil {
+			return err
+		}
+		err = c.putDailyVolume(order.Account, leg.currency, day, volume+leg.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAccountTier set the KYC tier of an account
+// args: account, tier
+func (c *ExchangeChaincode) setAccountTier() pb.Response {
+	myLogger.Debug("Set Account Tier...")
+
+	owner := c.args[0]
+	tier, _ := strconv.Atoi(c.args[1])
+	if tier < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The tier must be >= 0"))
+	}
+
+	info, err := c.getAccountInfo(owner)
+	if err != nil {
+		myLogger.Errorf("setAccountTier error1:%s", err)
+		return errorResponse(err)
+	}
+	info.Tier = tier
+	err = c.putAccountInfo(info)
+	if err != nil {
+		myLogger.Errorf("setAccountTier error2:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Set Account Tier...done")
+	return shim.Success(nil)
+}
+
+// setTierLimit set the limits of a tier for a currency
+// args: json{currency, tier, maxTrade, maxDailyVolume, maxHolding}
+func (c *ExchangeChaincode) setTierLimit() pb.Response {
+	myLogger.Debug("Set Tier Limit...")
+
+	limit := new(TierLimit)
+	err := json.Unmarshal([]byte(c.args[0]), limit)
+	if err != nil {
+		myLogger.Errorf("setTierLimit error1:%s", err)
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling tier limit: [%s]", err))
+	}
+	if limit.Tier < 0 || limit.MaxTrade < 0 || limit.MaxDailyVolume < 0 || limit.MaxHolding < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The tier and limits must be >= 0"))
+	}
+
+	curr, err := c.getCurrencyByName(limit.Currency)
+	if err != nil {
+		myLogger.Errorf("setTierLimit error2:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", limit.Currency, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", limit.Currency).With("currency", limit.Currency))
+	}
+
+	err = c.putTierLimit(limit)
+	if err != nil {
+		myLogger.Errorf("setTierLimit error3:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Set Tier Limit...done")
+	return shim.Success(nil)
+}
+
+// queryTierLimit
+// args: currency, tier
+func (c *ExchangeChaincode) queryTierLimit() pb.Response {
+	myLogger.Debug("queryTierLimit...")
+
+	tier, _ := strconv.Atoi(c.args[1])
+	limit, err := c.getTierLimit(c.args[0], tier)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if limit == nil {
+		return errorResponse(NoDataErr)
+	}
+
+	payload, err := json.Marshal(limit)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+)
+
+// newLimitEnv makes "kyc" a compliance officer and puts tier 1 under the BTC limit
+func newLimitEnv(t *testing.T, limit string) *testEnv {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "grantRole", e.acct("kyc"), string(RoleCompliance))
+	e.mustInvoke("kyc", "setTierLimit", limit)
+	return e
+}
+
+func TestMatchSkipsBookOrdersOverTheDailyVolume(t *testing.T) {
+	e := newLimitEnv(t, `{"currency":"BTC","tier":1,"maxDailyVolume":15}`)
+	e.mustInvoke("kyc", "setAccountTier", e.acct("alice"), "1")
+	e.assign("BTC", "alice", 100)
+	e.assign("BTC", "carol", 100)
+	e.assign("ETH", "bob", 100)
+
+	// alice's order is first in price-time priority but she can only trade 15 BTC a day
+	e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	alice := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	e.now++
+	carol := e.placeOrder("carol", "BTC", 10, "ETH", 20)
+	e.now++
+	e.placeOrder("bob", "ETH", 60, "BTC", 30)
+
+	payload := e.mustInvoke("op", "match", "BTC", "ETH")
+	result := new(MatchResult)
+	mustUnmarshal(t, payload, result)
+	if len(result.Fills) != 2 || len(result.Skipped) != 1 || result.Skipped[0].Id != alice || result.Skipped[0].Code != CodeLimitExceeded {
+		t.Fatalf("match filled %+v and skipped %+v", result.Fills, result.Skipped)
+	}
+
+	e.checkBalance("alice", "BTC", 80, 10)
+	e.checkBalance("carol", "ETH", 20, 0)
+	if status := e.order(carol).Status; status != OrderFilled {
+		t.Fatalf("carol's order is %s", status)
+	}
+}
+
+func TestMatchSkipsBookOrdersOverTheMaxHolding(t *testing.T) {
+	e := newLimitEnv(t, `{"currency":"BTC","tier":1,"maxHolding":5}`)
+	e.mustInvoke("kyc", "setAccountTier", e.acct("bob"), "1")
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+
+	e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	bob := e.placeOrder("bob", "ETH", 20, "BTC", 10)
+
+	result := new(MatchResult)
+	mustUnmarshal(t, e.mustInvoke("op", "match", "BTC", "ETH"), result)
+	if len(result.Fills) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Id != bob {
+		t.Fatalf("match filled %+v and skipped %+v", result.Fills, result.Skipped)
+	}
+	e.checkBalance("bob", "ETH", 80, 20)
+}
+
+func TestExchangeChecksTheDailyVolume(t *testing.T) {
+	e := newLimitEnv(t, `{"currency":"BTC","tier":0,"maxDailyVolume":8}`)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+	e.lockFor("alice", "A1", "BTC", 10, "ETH", 20)
+	e.lockFor("bob", "B1", "ETH", 40, "BTC", 20)
+
+	batch := e.exchange(
+		e.pairJSON(fill{"bob", "B1-1", "B1", 10, 5, 0}, fill{"alice", "A1-1", "A1", 5, 10, 0}),
+		e.pairJSON(fill{"bob", "B1-2", "B1", 10, 5, 0}, fill{"alice", "A1-2", "A1", 5, 10, 0}),
+	)
+	checkBatch(t, batch, 1, CodeLimitExceeded)
+
+	// the volume is per day
+	e.now += dayMillis
+	checkBatch(t, e.exchange(e.pairJSON(fill{"bob", "B1-3", "B1", 10, 5, 0}, fill{"alice", "A1-3", "A1", 5, 10, 0})), 1)
+	e.checkBalance("alice", "ETH", 20, 0)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ActiveLock is a lock not unlocked yet.
+// TimeLeft is the time until the lock can be released, -1 when it has no ttl.
+type ActiveLock struct {
+	*LockLog
+	Remaining int64 `json:"remaining"`
+	TimeLeft  int64 `json:"timeLeft"`
+}
+
+// isExpired reports whether the lock has a ttl that ended before now
+func (l *LockLog) isExpired(now int64) bool {
+	return l.ExpireTime != 0 && l.ExpireTime < now
+}
+
+// isOrderExpired reports whether the order the lock funds expired before now
+func (l *LockLog) isOrderExpired(now int64) bool {
+	return l.OrderLimit != nil && l.ExpiredTime != 0 && l.ExpiredTime < now
+}
+
+// activeLock returns the part of a lock not used by fills and the time until it can be released
+func (c *ExchangeChaincode) activeLock(log *LockLog) (*ActiveLock, error) {
+	fills, err := c.getFills(log.Order)
+	if err != nil {
+		return nil, err
+	}
+	remaining := log.LockCount
+	for _, fill := range fills {
+		if fill.Account == log.Owner && fill.SrcCurrency == log.Currency {
+			remaining -= fill.FinalCost
+		}
+	}
+
+	timeLeft := int64(-1)
+	if log.ExpireTime != 0 {
+		timeLeft = log.ExpireTime - c.now
+		if timeLeft < 0 {
+			timeLeft = 0
+		}
+	}
+	return &ActiveLock{LockLog: log, Remaining: remaining, TimeLeft: timeLeft}, nil
+}
+
+// getActiveLocks returns a page of the locks of an owner that are not unlocked
+// and the bookmark of the next page. The unlock of an order sorts right before
+// its lock in the index, so a closed lock is passed over without reading it.
+func (c *ExchangeChaincode) getActiveLocks(owner string, pageSize int, bookmark string) ([]*ActiveLock, string, error) {
+	ranges := []keyRange{{"LockLog~owner~curr~order~islock~uuid", []string{owner}}}
+
+	active := []*ActiveLock{}
+	next, last, unlocked := "", "", ""
+	err := c.scanKeys(ranges, bookmark, func(key string) (bool, error) {
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return false, err
+		}
+		order := parts[1] + "\x00" + parts[2]
+		islock, _ := strconv.ParseBool(parts[3])
+		if !islock {
+			unlocked = order
+			return true, nil
+		}
+		if order == unlocked {
+			return true, nil
+		}
+		if len(active) == pageSize {
+			next = encodeBookmark(last)
+			return false, nil
+		}
+
+		log, err := c.getLockLog(parts[4])
+		if err != nil {
+			return false, err
+		}
+		if log == nil {
+			return true, nil
+		}
+		lock, err := c.activeLock(log)
+		if err != nil {
+			return false, err
+		}
+		active = append(active, lock)
+		last = key
+		return true, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return active, next, nil
+}
+
+// releaseExpiredLocks return the unused balance of expired locks to the owners,
+// reading at most maxSweepOrders locks, oldest expiry first
+// args: none
+func (c *ExchangeChaincode) releaseExpiredLocks() pb.Response {
+	myLogger.Debug("Release Expired Locks...")
+
+	logs, err := c.getExpiredLocks(c.now, maxSweepOrders)
+	if err != nil {
+		myLogger.Errorf("releaseExpiredLocks error1:%s", err)
+		return errorResponse(err)
+	}
+
+	var successInfos []string
+	var failInfos []FailInfo
+
+	for _, log := range logs {
+		lock, err := c.activeLock(log)
+		if err != nil {
+			myLogger.Errorf("releaseExpiredLocks error2:%s", err)
+			return errorResponse(err)
+		}
+
+		// an unlock of zero still closes the lock
+		err, errType := c.lockOrUnlockBalance(lock.Owner, lock.Currency, lock.Order, lock.Remaining, false, 0, nil)
+		if errType == CheckErr && err != ExecedErr {
+			failInfos = append(failInfos, newFailInfo(lock.Order, err))
+			continue
+		} else if errType == WorldStateErr {
+			myLogger.Errorf("releaseExpiredLocks error3:%s", err)
+			return errorResponse(err)
+		}
+		successInfos = append(successInfos, lock.Order)
+	}
+
+	batch := BatchResult{EventName: "chaincode_releaseExpiredLocks", Success: successInfos, Fail: failInfos}
+	result, err := json.Marshal(&batch)
+	if err != nil {
+		myLogger.Errorf("releaseExpiredLocks error4:%s", err)
+		return errorResponse(err)
+	}
+	c.stub.SetEvent(batch.EventName, result)
+
+	myLogger.Debug("Release Expired Locks...done")
+	return shim.Success(result)
+}
+
+// queryMyLocks
+// args: [owner], [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryMyLocks() pb.Response {
+	myLogger.Debug("queryMyLocks...")
+
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	locks, next, err := c.getActiveLocks(owner, pageSize, bookmark)
+	if err != nil {
+		myLogger.Errorf("queryMyLocks error1:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&Page{Records: locks, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
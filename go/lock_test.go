@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// lockWithTTL locks BTC of a test user for an off chain order, releasable after ttl
+func (e *testEnv) lockWithTTL(who, orderID string, count, ttl int64) {
+	e.t.Helper()
+	e.mustInvoke("op", "lock", fmt.Sprintf(`[{"owner":"%s","currency":"BTC","orderId":"%s","count":%d,"desCurrency":"ETH","desCount":%d,"ttl":%d}]`,
+		e.acct(who), orderID, count, count, ttl), "true", "test")
+	var batch BatchResult
+	e.event("chaincode_lock", &batch)
+	checkBatch(e.t, batch, 1)
+}
+
+// releaseExpiredLocks releases the expired locks as a user with no role and returns the released orders
+func (e *testEnv) releaseExpiredLocks() []string {
+	e.t.Helper()
+	e.mustInvoke("carol", "releaseExpiredLocks")
+	var batch BatchResult
+	e.event("chaincode_releaseExpiredLocks", &batch)
+	checkBatch(e.t, batch, len(batch.Success))
+	return batch.Success
+}
+
+func TestReleaseExpiredLocksReleasesOnlyExpiredLocks(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.lockWithTTL("alice", "A1", 10, 1000)
+	e.lockWithTTL("alice", "A2", 20, 5000)
+	e.lockFor("alice", "A3", "BTC", 30, "ETH", 30)
+
+	if released := e.releaseExpiredLocks(); len(released) != 0 {
+		t.Fatalf("released %v before any ttl ended", released)
+	}
+
+	e.now += 2000
+	if released := e.releaseExpiredLocks(); len(released) != 1 || released[0] != "A1" {
+		t.Fatalf("released %v, expected A1", released)
+	}
+	e.checkBalance("alice", "BTC", 50, 50)
+
+	// the released lock left the expiry index
+	if released := e.releaseExpiredLocks(); len(released) != 0 {
+		t.Fatalf("released %v again", released)
+	}
+
+	e.now += 5000
+	if released := e.releaseExpiredLocks(); len(released) != 1 || released[0] != "A2" {
+		t.Fatalf("released %v, expected A2", released)
+	}
+	e.checkBalance("alice", "BTC", 70, 30)
+}
+
+func TestReleaseExpiredLocksKeepsTheFilledPart(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+	e.lockWithTTL("alice", "A1", 10, 1000)
+	e.lockFor("bob", "B1", "ETH", 40, "BTC", 20)
+	checkBatch(t, e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 4, 4, 0}, fill{"alice", "A1-1", "A1", 4, 4, 0})), 1)
+
+	// an expired lock can't be filled any more
+	e.now += 2000
+	checkBatch(t, e.exchange(e.pairJSON(fill{"bob", "B1-2", "B1", 4, 4, 0}, fill{"alice", "A1-2", "A1", 4, 4, 0})), 0, CodeLockExpired)
+
+	if released := e.releaseExpiredLocks(); len(released) != 1 {
+		t.Fatalf("released %v, expected A1", released)
+	}
+	e.checkBalance("alice", "BTC", 96, 0)
+	e.checkBalance("alice", "ETH", 4, 0)
+}
+
+func TestUnlockTakesTheLockOutOfTheExpiryIndex(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.lockWithTTL("alice", "A1", 10, 1000)
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A1","count":10}]`, "false", "test")
+	e.checkBalance("alice", "BTC", 100, 0)
+
+	e.now += 2000
+	if released := e.releaseExpiredLocks(); len(released) != 0 {
+		t.Fatalf("released %v after the unlock", released)
+	}
+	e.checkBalance("alice", "BTC", 100, 0)
+}
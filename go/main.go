@@ -12,23 +12,65 @@ var myLogger = logging.MustGetLogger("exchange")
 type ExchangeChaincode struct {
 	stub shim.ChaincodeStubInterface
 	args []string
+	seq  int
+
+	clock  Clock
+	now    int64
+	caller string
+	writes map[string][]byte
 }
 
 // Init init
 func (c *ExchangeChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	myLogger.Debug("Init Chaincode...")
 
+	// args: operator accounts allowed to act on behalf of other users
 	args := stub.GetStringArgs()
-	if len(args) != 0 {
-		return shim.Error("Incorrect number of arguments. Expecting 0")
-	}
 
 	c.stub = stub
 	c.args = args
+	c.seq = 0
+	c.caller = ""
+	c.writes = nil
+
+	now, err := c.txTime(stub)
+	if err != nil {
+		return errorResponse(newError(CodeInternal, "Failed retrieving transaction time: [%s]", err))
+	}
+	c.now = now
 
-	err := c.initCurrency()
+	err = c.initCurrency()
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+
+	// the deployer administers roles, a later Init must be run by an admin
+	admin, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	bootstrapped, err := c.hasAdmin()
+	if err != nil {
+		return errorResponse(err)
+	}
+	if bootstrapped {
+		err = c.checkRole(admin, RoleAdmin)
+	} else {
+		err = c.putRole(admin, RoleAdmin)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	for _, operator := range args {
+		err = checkAccountID(operator)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = c.putRole(operator, RoleOperator)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
 	myLogger.Debug("Init Chaincode...done")
@@ -43,38 +85,21 @@ func (c *ExchangeChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response
 	function, args := stub.GetFunctionAndParameters()
 	c.stub = stub
 	c.args = args
+	c.seq = 0
+	c.caller = ""
+	c.writes = nil
 
-	if function == "initAccount" {
-		return c.initAccount()
-	} else if function == "create" {
-		return c.create()
-	} else if function == "release" {
-		return c.release()
-	} else if function == "assign" {
-		return c.assign()
-	} else if function == "lock" {
-		return c.lock()
-	} else if function == "exchange" {
-		return c.exchange()
-	} else if function == "queryCurrencyByID" {
-		return c.queryCurrencyByID()
-	} else if function == "queryAllCurrency" {
-		return c.queryAllCurrency()
-	} else if function == "queryTxLogs" {
-		return c.queryTxLogs()
-	} else if function == "queryAssetByOwner" {
-		return c.queryAssetByOwner()
-	} else if function == "queryMyCurrency" {
-		return c.queryMyCurrency()
-	} else if function == "queryMyReleaseLog" {
-		return c.queryMyReleaseLog()
-	} else if function == "queryMyAssignLog" {
-		return c.queryMyAssignLog()
+	now, err := c.txTime(stub)
+	if err != nil {
+		return errorResponse(newError(CodeInternal, "Failed retrieving transaction time: [%s]", err))
 	}
+	c.now = now
+
+	resp := c.route(function)
 
 	myLogger.Debug("Invoke Chaincode...done")
 
-	return shim.Success([]byte("Invalid invoke function name. Expecting \"invoke\" \"query\""))
+	return resp
 }
 
 func main() {
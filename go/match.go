@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	defaultMatchFills = 50
+	maxMatchFills     = 200
+
+	// maxMatchReads bounds the book entries read by one match call
+	maxMatchReads = 1000
+)
+
+// Fill is one trade generated by the matching engine
+type Fill struct {
+	AskOrder  string `json:"askOrder"`
+	BidOrder  string `json:"bidOrder"`
+	AskFill   string `json:"askFill"`
+	BidFill   string `json:"bidFill"`
+	SrcCount  int64  `json:"srcCount"`
+	DesCount  int64  `json:"desCount"`
+	MatchTime int64  `json:"matchTime"`
+}
+
+// MatchResult MatchResult
+type MatchResult struct {
+	EventName   string     `json:"eventName"`
+	SrcCurrency string     `json:"srcCurrency"`
+	DesCurrency string     `json:"desCurrency"`
+	Fills       []Fill     `json:"fills"`
+	Skipped     []FailInfo `json:"skipped,omitempty"`
+}
+
+// mulDiv returns a*b/c rounded down, or up when ceil is set
+func mulDiv(a, b, c int64, ceil bool) int64 {
+	n := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	q, m := new(big.Int).DivMod(n, big.NewInt(c), new(big.Int))
+	if ceil && m.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q.Int64()
+}
+
+// mulGTE reports whether a*b >= c*d
+func mulGTE(a, b, c, d int64) bool {
+	l := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	r := new(big.Int).Mul(big.NewInt(c), big.NewInt(d))
+	return l.Cmp(r) >= 0
+}
+
+// crosses reports whether the bid pays at least the ask's limit price
+func crosses(ask, bid *Order) bool {
+	return mulGTE(bid.SrcCount, ask.SrcCount, ask.DesCount, bid.DesCount)
+}
+
+// fillAmounts returns how much of the ask's source (srcQty) trades for how much of
+// the bid's source (desQty) at the price of the older order. Both are zero when the
+// remaining counts are too small to trade within both limit prices.
+func fillAmounts(ask, bid *Order) (int64, int64) {
+	num, den, ceil := ask.DesCount, ask.SrcCount, true
+	if bid.PendingTime < ask.PendingTime {
+		num, den, ceil = bid.SrcCount, bid.DesCount, false
+	}
+
+	srcQty := ask.remaining()
+	desQty := mulDiv(srcQty, num, den, ceil)
+	if desQty > bid.remaining() {
+		desQty = bid.remaining()
+		srcQty = mulDiv(desQty, den, num, false)
+	}
+
+	if srcQty <= 0 || desQty <= 0 ||
+		!mulGTE(desQty, ask.SrcCount, srcQty, ask.DesCount) ||
+		!mulGTE(srcQty, bid.SrcCount, desQty, bid.DesCount) {
+		return 0, 0
+	}
+	return srcQty, desQty
+}
+
+// bookCursor walks one side of the book in price-time priority. It reads the
+// orders one by one and skips the ones that can't trade.
+type bookCursor struct {
+	c     *ExchangeChaincode
+	iter  shim.StateQueryIteratorInterface
+	reads *int
+	order *Order
+}
+
+// newBookCursor opens a cursor on the open orders selling srcCurrency for desCurrency
+func (c *ExchangeChaincode) newBookCursor(srcCurrency, desCurrency string, reads *int) (*bookCursor, error) {
+	iter, err := c.stub.GetStateByPartialCompositeKey("BookOrder~src~des~price~time~uuid", []string{srcCurrency, desCurrency})
+	if err != nil {
+		return nil, err
+	}
+	cur := &bookCursor{c: c, iter: iter, reads: reads}
+	return cur, cur.next()
+}
+
+// next moves to the next tradable order, order is nil at the end of the book or
+// once the reads of the match are used up. Expired orders are left on the book
+// for sweepExpired, the orders of accounts that are not active are passed over.
+func (cur *bookCursor) next() error {
+	cur.order = nil
+	for cur.iter.HasNext() && *cur.reads < maxMatchReads {
+		*cur.reads++
+		key, _, err := cur.iter.Next()
+		if err != nil {
+			return err
+		}
+		_, parts, err := cur.c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return err
+		}
+		order, err := cur.c.getOrder(parts[4])
+		if err != nil {
+			return err
+		}
+		if order == nil || !order.isOpen() || order.isExpired(cur.c.now) {
+			continue
+		}
+		info, err := cur.c.getAccountInfo(order.Account)
+		if err != nil {
+			return err
+		}
+		if info.Status != AccountActive {
+			continue
+		}
+		cur.order = order
+		return nil
+	}
+	return nil
+}
+
+// newFill creates the child order recording one fill of a book order
+func (c *ExchangeChaincode) newFill(parent *Order, give, get int64) *Order {
+	fill := *parent
+	fill.UUID = c.newUUID()
+	fill.RawUUID = parent.UUID
+	fill.SrcCount = give
+	fill.DesCount = get
+	fill.FinalCost = give
+	fill.IsBuyAll = false
+	fill.MatchedTime = c.now
+	fill.Status = ""
+	fill.SrcFilled = 0
+	fill.DesFilled = 0
+	return &fill
+}
+
+// applyFill updates a book order after a fill
+func (c *ExchangeChaincode) applyFill(order *Order, give, get int64) error {
+	order.SrcFilled += give
+	order.DesFilled += get
+	order.MatchedTime = c.now
+	if order.remaining() == 0 {
+		order.Status = OrderFilled
+		order.FinishedTime = c.now
+	} else {
+		order.Status = OrderPartial
+	}
+	return c.putOrder(order)
+}
+
+// settleFill settles one fill between an ask and a bid through execTx. When a side
+// is over the limits of its KYC tier nothing is settled, and that book order is
+// returned with the error so match can skip it.
+func (c *ExchangeChaincode) settleFill(ask, bid *Order, srcQty, desQty int64) (*Fill, *Order, error) {
+	askFill := c.newFill(ask, srcQty, desQty)
+	bidFill := c.newFill(bid, desQty, srcQty)
+
+	err := c.checkTradeLimits(askFill)
+	if err != nil {
+		return nil, ask, err
+	}
+	err = c.checkTradeLimits(bidFill)
+	if err != nil {
+		return nil, bid, err
+	}
+
+	err, _ = c.execTx(askFill, bidFill)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = c.putTxLog(askFill, bidFill)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = c.applyFill(ask, srcQty, desQty)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = c.applyFill(bid, desQty, srcQty)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Fill{
+		AskOrder:  ask.UUID,
+		BidOrder:  bid.UUID,
+		AskFill:   askFill.UUID,
+		BidFill:   bidFill.UUID,
+		SrcCount:  srcQty,
+		DesCount:  desQty,
+		MatchTime: c.now,
+	}, nil, nil
+}
+
+// match match the open orders of a currency pair in price-time priority. It walks
+// both sides of the book from the best price and stops after max fills or
+// maxMatchReads book entries, the orders of an account don't trade with each other.
+// args: srcCurrency, desCurrency, [max fills]
+func (c *ExchangeChaincode) match() pb.Response {
+	myLogger.Debug("Match...")
+
+	srcCurrency := c.args[0]
+	desCurrency := c.args[1]
+	maxFills := int64(defaultMatchFills)
+	if len(c.args) > 2 {
+		maxFills, _ = strconv.ParseInt(c.args[2], 10, 64)
+		if maxFills <= 0 || maxFills > maxMatchFills {
+			return errorResponse(newError(CodeInvalidArgument, "The max fills must be between 1 and %d", maxMatchFills))
+		}
+	}
+
+	for _, name := range []string{srcCurrency, desCurrency} {
+		err := c.checkCurrencyAllows(name, "be matched", (*Currency).canTrade)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	reads := 0
+	asks, err := c.newBookCursor(srcCurrency, desCurrency, &reads)
+	if err != nil {
+		myLogger.Errorf("match error1:%s", err)
+		return errorResponse(err)
+	}
+	defer asks.iter.Close()
+	bids, err := c.newBookCursor(desCurrency, srcCurrency, &reads)
+	if err != nil {
+		myLogger.Errorf("match error2:%s", err)
+		return errorResponse(err)
+	}
+	defer bids.iter.Close()
+
+	result := MatchResult{EventName: "chaincode_match", SrcCurrency: srcCurrency, DesCurrency: desCurrency, Fills: []Fill{}}
+
+	for asks.order != nil && bids.order != nil && int64(len(result.Fills)) < maxFills {
+		ask, bid := asks.order, bids.order
+		if !crosses(ask, bid) {
+			break
+		}
+
+		// an account doesn't trade with itself, the newer order is passed over
+		var skip *Order
+		if ask.Account == bid.Account {
+			skip = ask
+			if bid.PendingTime > ask.PendingTime {
+				skip = bid
+			}
+			err = newError(CodeSelfTrade, "The orders [%s] and [%s] are of the same account", ask.UUID, bid.UUID)
+		} else if srcQty, desQty := fillAmounts(ask, bid); srcQty == 0 {
+			// the smaller side can't trade at this price any more, skip it
+			if mulGTE(bid.remaining(), ask.SrcCount, ask.remaining(), ask.DesCount) {
+				err = asks.next()
+			} else {
+				err = bids.next()
+			}
+			if err != nil {
+				myLogger.Errorf("match error4:%s", err)
+				return errorResponse(err)
+			}
+			continue
+		} else {
+			var fill *Fill
+			fill, skip, err = c.settleFill(ask, bid, srcQty, desQty)
+			if err != nil && skip == nil {
+				myLogger.Errorf("match error3:%s", err)
+				return errorResponse(err)
+			}
+			if fill != nil {
+				result.Fills = append(result.Fills, *fill)
+			}
+		}
+
+		if skip != nil {
+			result.Skipped = append(result.Skipped, newFailInfo(skip.UUID, err))
+		}
+		if skip == ask || ask.remaining() == 0 {
+			err = asks.next()
+			if err != nil {
+				myLogger.Errorf("match error5:%s", err)
+				return errorResponse(err)
+			}
+		}
+		if skip == bid || bid.remaining() == 0 {
+			err = bids.next()
+			if err != nil {
+				myLogger.Errorf("match error6:%s", err)
+				return errorResponse(err)
+			}
+		}
+	}
+
+	payload, err := json.Marshal(&result)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent(result.EventName, payload)
+
+	myLogger.Debug("Match...done")
+	return shim.Success(payload)
+}
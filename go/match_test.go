@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+// match matches BTC against ETH and returns the result
+func (e *testEnv) match(args ...string) *MatchResult {
+	e.t.Helper()
+	result := new(MatchResult)
+	mustUnmarshal(e.t, e.mustInvoke("op", "match", append([]string{"BTC", "ETH"}, args...)...), result)
+	return result
+}
+
+func TestMatchFillsInPriceTimePriority(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("BTC", "carol", 100)
+	e.assign("ETH", "bob", 100)
+
+	worse := e.placeOrder("carol", "BTC", 10, "ETH", 30)
+	e.now++
+	better := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	e.now++
+	bid := e.placeOrder("bob", "ETH", 30, "BTC", 10)
+
+	result := e.match()
+	if len(result.Fills) != 1 || result.Fills[0].AskOrder != better || result.Fills[0].BidOrder != bid {
+		t.Fatalf("match filled %+v", result.Fills)
+	}
+	// the older ask sets the price, bob pays 20 ETH of his 30
+	if result.Fills[0].SrcCount != 10 || result.Fills[0].DesCount != 20 {
+		t.Fatalf("the fill traded %d BTC for %d ETH", result.Fills[0].SrcCount, result.Fills[0].DesCount)
+	}
+	e.checkBalance("alice", "ETH", 20, 0)
+	e.checkBalance("bob", "BTC", 10, 0)
+	if status := e.order(worse).Status; status != OrderOpen {
+		t.Fatalf("carol's order is %s", status)
+	}
+}
+
+func TestMatchStopsAtMaxFills(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+	for i := 0; i < 3; i++ {
+		e.placeOrder("alice", "BTC", 1, "ETH", 2)
+		e.now++
+	}
+	e.placeOrder("bob", "ETH", 6, "BTC", 3)
+
+	if fills := len(e.match("2").Fills); fills != 2 {
+		t.Fatalf("match made %d fills", fills)
+	}
+	if fills := len(e.match("2").Fills); fills != 1 {
+		t.Fatalf("match made %d fills", fills)
+	}
+	e.checkBalance("bob", "BTC", 3, 0)
+}
+
+func TestMatchSkipsSelfTrades(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "alice", 100)
+	e.assign("ETH", "bob", 100)
+
+	ask := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	e.now++
+	own := e.placeOrder("alice", "ETH", 20, "BTC", 10)
+	e.now++
+	bid := e.placeOrder("bob", "ETH", 20, "BTC", 10)
+
+	// alice's newer bid is passed over, her ask trades with bob
+	result := e.match()
+	if len(result.Skipped) != 1 || result.Skipped[0].Id != own || result.Skipped[0].Code != CodeSelfTrade {
+		t.Fatalf("match skipped %+v", result.Skipped)
+	}
+	if len(result.Fills) != 1 || result.Fills[0].AskOrder != ask || result.Fills[0].BidOrder != bid {
+		t.Fatalf("match filled %+v", result.Fills)
+	}
+	if status := e.order(own).Status; status != OrderOpen {
+		t.Fatalf("alice's bid is %s", status)
+	}
+	e.checkBalance("alice", "ETH", 100, 20)
+	e.checkBalance("alice", "BTC", 90, 0)
+}
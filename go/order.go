@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	OrderOpen      = "open"
+	OrderPartial   = "partial"
+	OrderFilled    = "filled"
+	OrderCancelled = "cancelled"
+	OrderExpired   = "expired"
+)
+
+// maxSweepOrders bounds the book orders or locks read by one sweepExpired or releaseExpiredLocks call
+const maxSweepOrders = 200
+
+// isOpen reports whether the order is still on the book
+func (o *Order) isOpen() bool {
+	return o.Status == OrderOpen || o.Status == OrderPartial
+}
+
+// isExpired reports whether the order expired before now
+func (o *Order) isExpired(now int64) bool {
+	return o.ExpiredTime != 0 && o.ExpiredTime < now
+}
+
+// remaining returns the source count not filled yet
+func (o *Order) remaining() int64 {
+	return o.SrcCount - o.SrcFilled
+}
+
+// pricePrecision is the scale of the price encoded in the order book index
+const pricePrecision = 100000000
+
+// priceKey encodes DesCount/SrcCount as a fixed width decimal so book keys sort by price
+func priceKey(order *Order) string {
+	price := new(big.Int).Mul(big.NewInt(order.DesCount), big.NewInt(pricePrecision))
+	price.Div(price, big.NewInt(order.SrcCount))
+	return fmt.Sprintf("%032s", price.String())
+}
+
+// timeKey encodes a time so book keys sort by time within a price
+func timeKey(t int64) string {
+	return fmt.Sprintf("%016d", t)
+}
+
+// placeOrder put an order on the book and lock its source balance
+// args: json{srcCurrency, srcCount, desCurrency, desCount, expiredTime, metadata}, [account] (operator only)
+func (c *ExchangeChaincode) placeOrder() pb.Response {
+	myLogger.Debug("Place Order...")
+
+	order := new(Order)
+	err := json.Unmarshal([]byte(c.args[0]), order)
+	if err != nil {
+		myLogger.Errorf("placeOrder error1:%s", err)
+		return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling order: [%s]", err))
+	}
+
+	account, err := c.getAccount(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if order.SrcCount <= 0 || order.DesCount <= 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The order counts must be > 0"))
+	}
+	if order.SrcCurrency == order.DesCurrency {
+		return errorResponse(newError(CodeInvalidArgument, "The order currencies must be different"))
+	}
+	if order.ExpiredTime != 0 && order.ExpiredTime <= c.now {
+		return errorResponse(newError(CodeInvalidArgument, "The order is already expired").With("expiredTime", order.ExpiredTime))
+	}
+	for _, name := range []string{order.SrcCurrency, order.DesCurrency} {
+		curr, err := c.getCurrencyByName(name)
+		if err != nil {
+			myLogger.Errorf("placeOrder error2:%s", err)
+			return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", name, err))
+		}
+		if curr == nil {
+			return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", name).With("currency", name))
+		}
+	}
+
+	order.UUID = c.newUUID()
+	order.RawUUID = order.UUID
+	order.Account = account
+	order.PendingTime = c.now
+	order.PendedTime = 0
+	order.MatchedTime = 0
+	order.FinishedTime = 0
+	order.FinalCost = 0
+	order.Status = OrderOpen
+	order.SrcFilled = 0
+	order.DesFilled = 0
+
+	err, _ = c.lockOrUnlockBalance(account, order.SrcCurrency, order.UUID, order.SrcCount, true, 0, &OrderLimit{DesCurrency: order.DesCurrency, DesCount: order.DesCount, ExpiredTime: order.ExpiredTime})
+	if err != nil {
+		myLogger.Errorf("placeOrder error3:%s", err)
+		return errorResponse(err)
+	}
+
+	err = c.putOrder(order)
+	if err != nil {
+		myLogger.Errorf("placeOrder error4:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_placeOrder", payload)
+
+	myLogger.Debug("Place Order...done")
+	return shim.Success(payload)
+}
+
+// cancelOrder take an open order off the book and unlock its balance
+// args: order id
+func (c *ExchangeChaincode) cancelOrder() pb.Response {
+	myLogger.Debug("Cancel Order...")
+
+	id := c.args[0]
+	order, err := c.getOrder(id)
+	if err != nil {
+		myLogger.Errorf("cancelOrder error1:%s", err)
+		return errorResponse(err)
+	}
+	if order == nil || order.Status == "" {
+		return errorResponse(newError(CodeNotFound, "The order [%s] does not exist", id).With("orderId", id))
+	}
+	if !order.isOpen() {
+		return errorResponse(newError(CodeAlreadyExecuted, "The order [%s] is %s", id, order.Status).With("orderId", id).With("status", order.Status))
+	}
+
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	if caller != order.Account {
+		err = c.checkRole(caller, RoleOperator)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	if order.remaining() > 0 {
+		err, _ = c.lockOrUnlockBalance(order.Account, order.SrcCurrency, order.UUID, order.remaining(), false, 0, nil)
+		if err != nil {
+			myLogger.Errorf("cancelOrder error2:%s", err)
+			return errorResponse(err)
+		}
+	}
+
+	order.Status = OrderCancelled
+	order.FinishedTime = c.now
+	err = c.putOrder(order)
+	if err != nil {
+		myLogger.Errorf("cancelOrder error3:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_cancelOrder", payload)
+
+	myLogger.Debug("Cancel Order...done")
+	return shim.Success(nil)
+}
+
+// ExpiryResult lists the orders expired by sweepExpired
+type ExpiryResult struct {
+	EventName string     `json:"eventName"`
+	Expired   []*Order   `json:"expired"`
+	Fail      []FailInfo `json:"fail"`
+}
+
+// sweepExpired unlock the remaining balance of expired orders. Book orders are
+// found on chain, orders settled by exchange are passed in by an operator and
+// their expiry is read from their lock.
+// args: [json []{uuid, account, srcCurrency}] (operator only)
+func (c *ExchangeChaincode) sweepExpired() pb.Response {
+	myLogger.Debug("Sweep Expired...")
+
+	result := ExpiryResult{EventName: "chaincode_orderExpired", Expired: []*Order{}}
+
+	book, err := c.getExpiredOrders(c.now, maxSweepOrders)
+	if err != nil {
+		myLogger.Errorf("sweepExpired error1:%s", err)
+		return errorResponse(err)
+	}
+	for _, order := range book {
+		if order.remaining() > 0 {
+			err, _ = c.lockOrUnlockBalance(order.Account, order.SrcCurrency, order.UUID, order.remaining(), false, 0, nil)
+			if err != nil {
+				myLogger.Errorf("sweepExpired error2:%s", err)
+				return errorResponse(err)
+			}
+		}
+
+		order.Status = OrderExpired
+		order.FinishedTime = c.now
+		err = c.putOrder(order)
+		if err != nil {
+			myLogger.Errorf("sweepExpired error3:%s", err)
+			return errorResponse(err)
+		}
+		result.Expired = append(result.Expired, order)
+	}
+
+	if len(c.args) > 0 {
+		err = c.checkCallerRole(RoleOperator)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		var orders []*Order
+		err = json.Unmarshal([]byte(c.args[0]), &orders)
+		if err != nil {
+			myLogger.Errorf("sweepExpired error4:%s", err)
+			return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling orders: [%s]", err))
+		}
+
+		for _, order := range orders {
+			err, errType := c.expireOrder(order)
+			if errType == CheckErr {
+				result.Fail = append(result.Fail, newFailInfo(order.UUID, err))
+				continue
+			} else if errType == WorldStateErr {
+				myLogger.Errorf("sweepExpired error5:%s", err)
+				return errorResponse(err)
+			}
+			result.Expired = append(result.Expired, order)
+		}
+	}
+
+	payload, err := json.Marshal(&result)
+	if err != nil {
+		myLogger.Errorf("sweepExpired error6:%s", err)
+		return errorResponse(err)
+	}
+	c.stub.SetEvent(result.EventName, payload)
+
+	myLogger.Debug("Sweep Expired...done")
+	return shim.Success(payload)
+}
+
+// expireOrder unlock what is left of the lock of an expired order settled by exchange.
+// The expiry and des currency of the order are read from its lock.
+func (c *ExchangeChaincode) expireOrder(order *Order) (error, ErrType) {
+	book, err := c.getOrder(order.UUID)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving order [%s]: [%s]", order.UUID, err), WorldStateErr
+	}
+	if book != nil && book.Status != "" {
+		return newError(CodeInvalidArgument, "The order [%s] is on the order book", order.UUID).With("orderId", order.UUID), CheckErr
+	}
+
+	lockLog, err := c.getLockLogByParm(order.Account, order.SrcCurrency, order.UUID, true)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving lock of order [%s]: [%s]", order.UUID, err), WorldStateErr
+	}
+	if lockLog == nil {
+		return newError(CodeLockNotFound, "The order [%s] is not locked", order.UUID).With("orderId", order.UUID), CheckErr
+	}
+	if !lockLog.isOrderExpired(c.now) {
+		expiredTime := int64(0)
+		if lockLog.OrderLimit != nil {
+			expiredTime = lockLog.ExpiredTime
+		}
+		return newError(CodeInvalidArgument, "The order [%s] is not expired", order.UUID).
+			With("orderId", order.UUID).With("expiredTime", expiredTime), CheckErr
+	}
+	order.DesCurrency = lockLog.DesCurrency
+	order.ExpiredTime = lockLog.ExpiredTime
+
+	left, err := c.computeBalance(order.Account, order.SrcCurrency, order.DesCurrency, order.UUID, 0)
+	if err != nil {
+		return err, CheckErr
+	}
+	if left > 0 {
+		err, errType := c.lockOrUnlockBalance(order.Account, order.SrcCurrency, order.UUID, left, false, 0, nil)
+		if err == ExecedErr {
+			return newError(CodeAlreadyExecuted, "The order [%s] is already unlocked", order.UUID).With("orderId", order.UUID), CheckErr
+		} else if err != nil {
+			return err, errType
+		}
+	}
+
+	order.SrcCount = left
+	order.FinishedTime = c.now
+	order.Status = OrderExpired
+	return nil, ErrType("")
+}
+
+// queryOrderBook
+// args: srcCurrency, desCurrency, [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryOrderBook() pb.Response {
+	myLogger.Debug("queryOrderBook...")
+
+	pageSize, bookmark, err := c.getPaging(2)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var orders []*Order
+	next, err := c.getPage(keyRange{"BookOrder~src~des~price~time~uuid", []string{c.args[0], c.args[1]}}, 4, pageSize, bookmark, &orders)
+	if err != nil {
+		myLogger.Errorf("queryOrderBook error1:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&Page{Records: orders, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
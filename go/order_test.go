@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlaceOrderLocksTheSourceAndListsTheOrder(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+
+	e.mustFail(CodeInvalidArgument, "alice", "placeOrder", `{"srcCurrency":"BTC","srcCount":0,"desCurrency":"ETH","desCount":20}`)
+	e.mustFail(CodeInvalidArgument, "alice", "placeOrder", `{"srcCurrency":"BTC","srcCount":10,"desCurrency":"BTC","desCount":20}`)
+	e.mustFail(CodeInsufficientBalance, "alice", "placeOrder", `{"srcCurrency":"BTC","srcCount":200,"desCurrency":"ETH","desCount":20}`)
+
+	cheap := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	dear := e.placeOrder("alice", "BTC", 10, "ETH", 30)
+	e.checkBalance("alice", "BTC", 80, 20)
+
+	// the book lists the best price first
+	var book []*Order
+	pageOf(t, e.mustInvoke("bob", "queryOrderBook", "BTC", "ETH"), &book)
+	if len(book) != 2 || book[0].UUID != cheap || book[1].UUID != dear {
+		t.Fatalf("The book is %+v", book)
+	}
+	if book[0].Status != OrderOpen || book[0].Account != e.acct("alice") {
+		t.Fatalf("The order is %+v", book[0])
+	}
+}
+
+func TestCancelOrderUnlocksTheRemainder(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	id := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+	e.checkBalance("alice", "BTC", 90, 10)
+
+	e.mustFail(CodeUnauthorized, "bob", "cancelOrder", id)
+	e.mustInvoke("alice", "cancelOrder", id)
+	e.mustFail(CodeAlreadyExecuted, "alice", "cancelOrder", id)
+
+	e.checkBalance("alice", "BTC", 100, 0)
+	if status := e.order(id).Status; status != OrderCancelled {
+		t.Fatalf("order is %s", status)
+	}
+}
+
+// placeExpiring places a book order selling BTC for ETH that expires after ttl
+func (e *testEnv) placeExpiring(who string, srcCount, desCount, ttl int64) string {
+	e.t.Helper()
+	order := new(Order)
+	mustUnmarshal(e.t, e.mustInvoke(who, "placeOrder", fmt.Sprintf(`{"srcCurrency":"BTC","srcCount":%d,"desCurrency":"ETH","desCount":%d,"expiredTime":%d}`,
+		srcCount, desCount, e.now+ttl)), order)
+	return order.UUID
+}
+
+func TestSweepExpiredExpiresOnlyExpiredBookOrders(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	soon := e.placeExpiring("alice", 10, 20, 1000)
+	later := e.placeExpiring("alice", 10, 20, 5000)
+	never := e.placeOrder("alice", "BTC", 10, "ETH", 20)
+
+	e.now += 2000
+	e.mustInvoke("bob", "sweepExpired")
+	var result ExpiryResult
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 1 || result.Expired[0].UUID != soon {
+		t.Fatalf("sweepExpired expired %+v", result.Expired)
+	}
+	e.checkBalance("alice", "BTC", 80, 20)
+
+	// the expired order left the expiry index, a second sweep reads nothing
+	e.mustInvoke("bob", "sweepExpired")
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 0 {
+		t.Fatalf("sweepExpired expired %+v", result.Expired)
+	}
+
+	e.now += 5000
+	e.mustInvoke("bob", "sweepExpired")
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 1 || result.Expired[0].UUID != later {
+		t.Fatalf("sweepExpired expired %+v", result.Expired)
+	}
+	e.checkBalance("alice", "BTC", 90, 10)
+	if status := e.order(never).Status; status != OrderOpen {
+		t.Fatalf("order without expiry is %s", status)
+	}
+}
+
+func TestSweepExpiredSkipsCancelledOrders(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	id := e.placeExpiring("alice", 10, 20, 1000)
+	e.mustInvoke("alice", "cancelOrder", id)
+
+	e.now += 2000
+	e.mustInvoke("bob", "sweepExpired")
+	var result ExpiryResult
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 0 {
+		t.Fatalf("sweepExpired expired %+v", result.Expired)
+	}
+	e.checkBalance("alice", "BTC", 100, 0)
+}
+
+func TestExchangeReadsTheExpiryFromTheLock(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.assign("ETH", "bob", 100)
+	e.mustInvoke("op", "lock", fmt.Sprintf(`[{"owner":"%s","currency":"BTC","orderId":"A1","count":10,"desCurrency":"ETH","desCount":20,"expiredTime":%d}]`,
+		e.acct("alice"), e.now+1000), "true", "test")
+	e.lockFor("bob", "B1", "ETH", 40, "BTC", 20)
+
+	// a forged expiry doesn't release funds of an order that is still live
+	e.mustInvoke("op", "sweepExpired", `[{"uuid":"A1","account":"`+e.acct("alice")+`","srcCurrency":"BTC","expiredTime":1}]`)
+	var result ExpiryResult
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 0 || len(result.Fail) != 1 {
+		t.Fatalf("sweepExpired expired %d orders and failed %+v", len(result.Expired), result.Fail)
+	}
+	e.checkBalance("alice", "BTC", 90, 10)
+
+	// nor does an expiredTime of 0 let an expired order be filled
+	e.now += 2000
+	batch := e.exchange(e.pairJSON(fill{"bob", "B1-1", "B1", 20, 10, 0}, fill{"alice", "A1-1", "A1", 10, 20, 0}))
+	checkBatch(t, batch, 0, CodeOrderExpired)
+
+	e.mustInvoke("op", "sweepExpired", `[{"uuid":"A1","account":"`+e.acct("alice")+`","srcCurrency":"BTC"}]`)
+	e.event("chaincode_orderExpired", &result)
+	if len(result.Expired) != 1 || len(result.Fail) != 0 {
+		t.Fatalf("sweepExpired expired %d orders and failed %+v", len(result.Expired), result.Fail)
+	}
+	e.checkBalance("alice", "BTC", 100, 0)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Page is one page of a list query. Bookmark is passed back to get the next
+// page and is empty on the last page.
+type Page struct {
+	Records  interface{} `json:"records"`
+	Bookmark string      `json:"bookmark,omitempty"`
+}
+
+// keyRange is the keys of an index matching a partial composite key
+type keyRange struct {
+	index string
+	attrs []string
+}
+
+// getPaging reads the optional page size and bookmark args starting at index
+func (c *ExchangeChaincode) getPaging(index int) (int, string, error) {
+	pageSize := defaultPageSize
+	if len(c.args) > index && c.args[index] != "" {
+		pageSize, _ = strconv.Atoi(c.args[index])
+		if pageSize <= 0 || pageSize > maxPageSize {
+			return 0, "", newError(CodeInvalidArgument, "The page size must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	bookmark := ""
+	if len(c.args) > index+1 && c.args[index+1] != "" {
+		b, err := base64.URLEncoding.DecodeString(c.args[index+1])
+		if err != nil {
+			return 0, "", newError(CodeInvalidArgument, "Invalid bookmark")
+		}
+		bookmark = string(b)
+	}
+
+	return pageSize, bookmark, nil
+}
+
+// scanKeys calls fn with the keys of the ranges, in order, after the bookmark until
+// fn returns false. It reads committed state only, list queries don't write.
+func (c *ExchangeChaincode) scanKeys(ranges []keyRange, bookmark string, fn func(key string) (bool, error)) error {
+	found := bookmark == ""
+
+	for _, r := range ranges {
+		prefix, err := c.stub.CreateCompositeKey(r.index, r.attrs)
+		if err != nil {
+			return err
+		}
+		inRange := !found && strings.HasPrefix(bookmark, prefix)
+		if !found && !inRange {
+			continue
+		}
+		found = true
+
+		// resume right after the bookmark rather than reading the range from its start
+		var resultsIterator shim.StateQueryIteratorInterface
+		if inRange {
+			resultsIterator, err = c.stub.GetStateByRange(bookmark+"\x00", prefix+string(utf8.MaxRune))
+		} else {
+			resultsIterator, err = c.stub.GetStateByPartialCompositeKey(r.index, r.attrs)
+		}
+		if err != nil {
+			return err
+		}
+
+		for resultsIterator.HasNext() {
+			key, _, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return err
+			}
+			more, err := fn(key)
+			if err != nil || !more {
+				resultsIterator.Close()
+				return err
+			}
+		}
+		resultsIterator.Close()
+	}
+
+	if !found {
+		return newError(CodeInvalidArgument, "Invalid bookmark")
+	}
+	return nil
+}
+
+// checkBookmark returns an error unless the bookmark is a key of one of the ranges
+func (c *ExchangeChaincode) checkBookmark(ranges []keyRange, bookmark string) error {
+	if bookmark == "" {
+		return nil
+	}
+	for _, r := range ranges {
+		prefix, err := c.stub.CreateCompositeKey(r.index, r.attrs)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(bookmark, prefix) {
+			return nil
+		}
+	}
+	return newError(CodeInvalidArgument, "Invalid bookmark")
+}
+
+// getKeysPage returns up to pageSize keys of the ranges after the bookmark
+// and the bookmark of the next page
+func (c *ExchangeChaincode) getKeysPage(ranges []keyRange, pageSize int, bookmark string) ([]string, string, error) {
+	var keys []string
+	next := ""
+
+	err := c.scanKeys(ranges, bookmark, func(key string) (bool, error) {
+		if len(keys) == pageSize {
+			next = encodeBookmark(keys[len(keys)-1])
+			return false, nil
+		}
+		keys = append(keys, key)
+		return true, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// encodeBookmark encodes the last key of a page as the bookmark of the next page
+func encodeBookmark(key string) string {
+	return base64.URLEncoding.EncodeToString([]byte(key))
+}
+
+// getValues reads the records the index keys point to, keyIndex is the attribute holding the record key
+func (c *ExchangeChaincode) getValues(keys []string, keyIndex int) ([][]byte, error) {
+	var bb [][]byte
+	for _, compositeKey := range keys {
+		_, compositeKeyParts, err := c.stub.SplitCompositeKey(compositeKey)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := c.getState(compositeKeyParts[keyIndex])
+		if err != nil {
+			return nil, err
+		}
+		bb = append(bb, b)
+	}
+	return bb, nil
+}
+
+// getPage reads a page of records of an index into records, a pointer to a slice
+func (c *ExchangeChaincode) getPage(r keyRange, keyIndex int, pageSize int, bookmark string, records interface{}) (string, error) {
+	keys, next, err := c.getKeysPage([]keyRange{r}, pageSize, bookmark)
+	if err != nil {
+		return "", err
+	}
+
+	bb, err := c.getValues(keys, keyIndex)
+	if err != nil {
+		return "", err
+	}
+
+	err = json.Unmarshal(joinJSON(bb), records)
+	if err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// joinJSON joins JSON values into a JSON array, skipping missing records
+func joinJSON(bb [][]byte) []byte {
+	buf := []byte{'['}
+	for _, b := range bb {
+		if len(b) == 0 {
+			continue
+		}
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, b...)
+	}
+	return append(buf, ']')
+}
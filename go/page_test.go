@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+func TestQueryAllCurrencyPages(t *testing.T) {
+	e := newTestEnv(t)
+
+	// Init created CNY and USD, the issuer BTC and ETH
+	var names []string
+	bookmark := ""
+	for pages := 0; pages == 0 || bookmark != ""; pages++ {
+		if pages > 4 {
+			t.Fatal("The pages don't end")
+		}
+		var currencies []*Currency
+		start := bookmark
+		bookmark = pageOf(t, e.mustInvoke("alice", "queryAllCurrency", "3", bookmark), &currencies)
+		if start != "" {
+			// the next page resumes after the bookmark
+			key, _ := base64.URLEncoding.DecodeString(start)
+			if len(e.ranges) == 0 || e.ranges[len(e.ranges)-1] != string(key)+"\x00" {
+				t.Fatalf("The page after %q read the ranges %q", key, e.ranges)
+			}
+		}
+		for _, curr := range currencies {
+			names = append(names, curr.Name)
+		}
+	}
+	if len(names) != 4 {
+		t.Fatalf("queryAllCurrency listed %v", names)
+	}
+
+	e.mustFail(CodeInvalidArgument, "alice", "queryAllCurrency", "0")
+	e.mustFail(CodeInvalidArgument, "alice", "queryAllCurrency", "1001")
+	e.mustFail(CodeInvalidArgument, "alice", "queryAllCurrency", "3", "%%%")
+}
+
+func TestQueryMyLocksPages(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	for i := 1; i <= 5; i++ {
+		e.lockFor("alice", fmt.Sprintf("A%d", i), "BTC", 1, "ETH", 2)
+	}
+	// unlocked orders are not listed
+	e.mustInvoke("op", "lock", `[{"owner":"`+e.acct("alice")+`","currency":"BTC","orderId":"A2","count":1}]`, "false", "test")
+
+	var orders []string
+	bookmark := ""
+	for pages := 0; pages == 0 || bookmark != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("The pages don't end")
+		}
+		var locks []*ActiveLock
+		bookmark = pageOf(t, e.mustInvoke("alice", "queryMyLocks", "", "2", bookmark), &locks)
+		if len(locks) > 2 {
+			t.Fatalf("The page has %d locks", len(locks))
+		}
+		for _, lock := range locks {
+			orders = append(orders, lock.Order)
+		}
+	}
+	if fmt.Sprint(orders) != "[A1 A3 A4 A5]" {
+		t.Fatalf("queryMyLocks listed %v", orders)
+	}
+
+	e.mustFail(CodeInvalidArgument, "alice", "queryMyLocks", "", "2", encodeBookmark("LockLog~owner~curr~order~islock~uuid\x00bob\x00"))
+}
+
+func TestQueryAccountStatusPages(t *testing.T) {
+	e := newTestEnv(t)
+	for _, status := range []string{AccountFrozen, AccountActive, AccountFrozen} {
+		e.mustInvoke("admin", "setAccountStatus", e.acct("alice"), status, "test")
+	}
+
+	var result struct {
+		Status   string              `json:"status"`
+		Logs     []*AccountStatusLog `json:"logs"`
+		Bookmark string              `json:"bookmark"`
+	}
+	mustUnmarshal(t, e.mustInvoke("alice", "queryAccountStatus", "", "2"), &result)
+	if result.Status != AccountFrozen || len(result.Logs) != 2 || result.Bookmark == "" {
+		t.Fatalf("queryAccountStatus returned %+v", result)
+	}
+
+	bookmark := result.Bookmark
+	result.Logs, result.Bookmark = nil, ""
+	mustUnmarshal(t, e.mustInvoke("alice", "queryAccountStatus", "", "2", bookmark), &result)
+	if len(result.Logs) != 1 || result.Bookmark != "" {
+		t.Fatalf("queryAccountStatus returned %+v", result)
+	}
+}
+
+func TestQueryAssetHistoryPages(t *testing.T) {
+	e := newTestEnv(t)
+	for i := 0; i < 3; i++ {
+		e.assign("BTC", "alice", 10)
+	}
+
+	var versions []*AssetVersion
+	bookmark := pageOf(t, e.mustInvoke("alice", "queryAssetHistory", "BTC", "", "2"), &versions)
+	if len(versions) != 2 || versions[0].Count != 10 || versions[1].Count != 20 || bookmark == "" {
+		t.Fatalf("queryAssetHistory returned %+v, bookmark %q", versions, bookmark)
+	}
+
+	versions = nil
+	bookmark = pageOf(t, e.mustInvoke("alice", "queryAssetHistory", "BTC", "", "2", bookmark), &versions)
+	if len(versions) != 1 || versions[0].Count != 30 || bookmark != "" {
+		t.Fatalf("queryAssetHistory returned %+v, bookmark %q", versions, bookmark)
+	}
+
+	e.mustFail(CodeInvalidArgument, "alice", "queryAssetHistory", "BTC", "", "2", encodeBookmark("unknown"))
+}
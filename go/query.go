@@ -11,173 +11,355 @@ import (
 func (c *ExchangeChaincode) queryCurrencyByID() pb.Response {
 	myLogger.Debug("queryCurrency...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-
 	name := c.args[0]
 
 	currency, err := c.getCurrencyByName(name)
 	if err != nil {
 		myLogger.Errorf("queryCurrencyByID error1:%s", err)
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	if currency == nil {
-		return shim.Error(NoDataErr.Error())
+		return errorResponse(NoDataErr)
 	}
 	payload, err := json.Marshal(&currency)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
 // queryAllCurrency
+// args: [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryAllCurrency() pb.Response {
 	myLogger.Debug("queryCurrency...")
 
-	if len(c.args) != 0 {
-		return shim.Error("Incorrect number of arguments. Expecting 0")
+	pageSize, bookmark, err := c.getPaging(0)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	infos, err := c.getAllCurrency()
+	var infos []*Currency
+	next, err := c.getPage(keyRange{"Currency~uuid", nil}, 0, pageSize, bookmark, &infos)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(infos) == 0 {
-		return shim.Error(NoDataErr.Error())
+	if len(infos) == 0 && bookmark == "" {
+		return errorResponse(NoDataErr)
 	}
 
-	payload, err := json.Marshal(&infos)
+	payload, err := json.Marshal(&Page{Records: infos, Bookmark: next})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
 // queryTxLogs
+// args: [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryTxLogs() pb.Response {
 	myLogger.Debug("queryTxLogs...")
 
-	if len(c.args) != 0 {
-		return shim.Error("Incorrect number of arguments. Expecting 0")
+	pageSize, bookmark, err := c.getPaging(0)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	infos, err := c.getAllTxLog()
+	var infos []*Order
+	next, err := c.getPage(keyRange{"Order~uuid", nil}, 0, pageSize, bookmark, &infos)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(infos) == 0 {
-		return shim.Error(NoDataErr.Error())
+	if len(infos) == 0 && bookmark == "" {
+		return errorResponse(NoDataErr)
 	}
 
-	payload, err := json.Marshal(&infos)
+	payload, err := json.Marshal(&Page{Records: infos, Bookmark: next})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
 // queryAssetByOwner
+// args: owner (auditor only for other accounts), [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryAssetByOwner() pb.Response {
 	myLogger.Debug("queryAssetByOwner...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	owner := c.args[0]
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	if owner != caller {
+		err = c.checkRole(caller, RoleAuditor)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	owner := c.args[0]
-	assets, err := c.getOwnerAllAsset(owner)
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var assets []*Asset
+	next, err := c.getPage(keyRange{"Asset~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &assets)
 	if err != nil {
 		myLogger.Errorf("queryAssetByOwner error1:%s", err)
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(assets) == 0 {
-		return shim.Error(NoDataErr.Error())
+	if len(assets) == 0 && bookmark == "" {
+		return errorResponse(NoDataErr)
 	}
-	payload, err := json.Marshal(&assets)
+	payload, err := json.Marshal(&Page{Records: assets, Bookmark: next})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
 // queryMyCurrency
+// args: [owner] (operator only), [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryMyCurrency() pb.Response {
 	myLogger.Debug("queryCurrency...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	owner := c.args[0]
-	currencys, err := c.getMyCurrency(owner)
+	var currencys []*Currency
+	next, err := c.getPage(keyRange{"Currency~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &currencys)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	payload, err := json.Marshal(&currencys)
+	payload, err := json.Marshal(&Page{Records: currencys, Bookmark: next})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
 // queryReleaseLog
+// args: [owner] (operator only), [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryMyReleaseLog() pb.Response {
 	myLogger.Debug("queryMyReleaseLog...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
 	}
-	owner := c.args[0]
-	logs, err := c.getMyReleaseLog(owner)
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var logs []*ReleaseLog
+	next, err := c.getPage(keyRange{"ReleaseLog~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &logs)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// queryMyBurnLog
+// args: [owner] (operator only), [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryMyBurnLog() pb.Response {
+	myLogger.Debug("queryMyBurnLog...")
+
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var logs []*BurnLog
+	next, err := c.getPage(keyRange{"BurnLog~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &logs)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// queryMyRedeemLog
+// args: [owner] (operator only), [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryMyRedeemLog() pb.Response {
+	myLogger.Debug("queryMyRedeemLog...")
+
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var logs []*RedeemLog
+	next, err := c.getPage(keyRange{"RedeemLog~owner~uuid", []string{owner}}, 1, pageSize, bookmark, &logs)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	payload, err := json.Marshal(logs)
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
 }
 
-// queryMyAssignLog
+// queryMyAssignLog pages through the logs of assigns to the owner, then from the owner
+// args: [owner] (operator only), [pageSize], [bookmark]
 func (c *ExchangeChaincode) queryMyAssignLog() pb.Response {
 	myLogger.Debug("queryAssignLog...")
 
-	if len(c.args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
 	}
-	owner := c.args[0]
-	logToMe, err := c.getFromAssignLog(owner)
+	pageSize, bookmark, err := c.getPaging(1)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	logMeTo, err := c.getToAssignLog(owner)
+	keys, next, err := c.getKeysPage([]keyRange{
+		{"AssignLog~to~uuid", []string{owner}},
+		{"AssignLog~from~uuid", []string{owner}},
+	}, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	logs := &struct {
 		ToMe []*AssignLog `json:"toMe"`
 		MeTo []*AssignLog `json:"meTo"`
-	}{
-		ToMe: logToMe,
-		MeTo: logMeTo,
+	}{}
+	for _, key := range keys {
+		index, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		log, err := c.getAssignLog(parts[1])
+		if err != nil {
+			return errorResponse(err)
+		}
+		if index == "AssignLog~to~uuid" {
+			logs.ToMe = append(logs.ToMe, log)
+		} else {
+			logs.MeTo = append(logs.MeTo, log)
+		}
+	}
+
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// OrderStatus OrderStatus
+type OrderStatus struct {
+	UUID   string   `json:"uuid"`
+	Status string   `json:"status"`
+	Size   int64    `json:"size"`
+	Filled int64    `json:"filled"`
+	Fills  []string `json:"fills"`
+}
+
+const (
+	StatusSettled   = "settled"
+	StatusPartial   = "partial"
+	StatusUntouched = "untouched"
+)
+
+// queryOrderStatus report whether an order was settled, partially filled or untouched
+// args: order id
+func (c *ExchangeChaincode) queryOrderStatus() pb.Response {
+	myLogger.Debug("queryOrderStatus...")
+
+	id := c.args[0]
+	status := &OrderStatus{UUID: id, Status: StatusUntouched, Fills: []string{}}
+
+	fills, err := c.getFills(id)
+	if err != nil {
+		myLogger.Errorf("queryOrderStatus error1:%s", err)
+		return errorResponse(err)
+	}
+	for _, fill := range fills {
+		status.Filled += fill.FinalCost
+		status.Fills = append(status.Fills, fill.UUID)
+	}
+
+	book, err := c.getOrder(id)
+	if err != nil {
+		myLogger.Errorf("queryOrderStatus error2:%s", err)
+		return errorResponse(err)
+	}
+	settled, err := c.isSettled(id)
+	if err != nil {
+		myLogger.Errorf("queryOrderStatus error3:%s", err)
+		return errorResponse(err)
+	}
+
+	if book != nil && book.Status != "" {
+		// order on the book
+		status.Status = book.Status
+		status.Size = book.SrcCount
+
+		payload, err := json.Marshal(status)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return shim.Success(payload)
+	}
+
+	if len(fills) > 0 {
+		lockLog, err := c.getLockLogByParm(fills[0].Account, fills[0].SrcCurrency, id, true)
+		if err != nil {
+			myLogger.Errorf("queryOrderStatus error4:%s", err)
+			return errorResponse(err)
+		}
+		if lockLog != nil {
+			status.Size = lockLog.LockCount
+		}
+	}
+
+	if settled || (len(fills) > 0 && status.Size > 0 && status.Filled >= status.Size) {
+		status.Status = StatusSettled
+	} else if len(fills) > 0 {
+		status.Status = StatusPartial
 	}
 
-	payload, err := json.Marshal(logs)
+	payload, err := json.Marshal(status)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(payload)
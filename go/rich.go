@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Rich queries run on the CouchDB state database only, the indexes they use are
+// shipped in META-INF/statedb/couchdb/indexes. On LevelDB GetQueryResult fails.
+
+// OrderSettled selects the settled fills, which carry no book status
+const OrderSettled = "settled"
+
+// orderQueryFields are the fields an order query may set
+var orderQueryFields = map[string]bool{
+	"currency": true, "account": true, "from": true, "to": true, "status": true,
+}
+
+// OrderQuery is the constrained selector of queryOrders. Currency matches either
+// side, From and To bound the PendingTime of book orders and the FinishedTime of fills.
+type OrderQuery struct {
+	Currency string `json:"currency"`
+	Account  string `json:"account"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	Status   string `json:"status"`
+}
+
+// parseOrderQuery reads and validates an order query, rejecting fields it doesn't know
+func parseOrderQuery(b []byte) (*OrderQuery, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, newError(CodeInvalidArgument, "Failed unmarshalling query: [%s]", err)
+	}
+	for name := range fields {
+		if !orderQueryFields[name] {
+			return nil, newError(CodeInvalidArgument, "Unsupported query field [%s]", name).With("field", name)
+		}
+	}
+
+	q := new(OrderQuery)
+	err = json.Unmarshal(b, q)
+	if err != nil {
+		return nil, newError(CodeInvalidArgument, "Failed unmarshalling query: [%s]", err)
+	}
+
+	switch q.Status {
+	case "", OrderSettled, OrderOpen, OrderPartial, OrderFilled, OrderCancelled, OrderExpired:
+	default:
+		return nil, newError(CodeInvalidArgument, "Invalid order status [%s]", q.Status).With("status", q.Status)
+	}
+	if q.From < 0 || q.To < 0 || (q.To != 0 && q.To < q.From) {
+		return nil, newError(CodeInvalidArgument, "Invalid time range [%d, %d]", q.From, q.To)
+	}
+	return q, nil
+}
+
+// orderIndex is a shipped index queryOrders sorts on, its last field is a time
+type orderIndex struct {
+	name   string
+	fields []string
+}
+
+func (i orderIndex) timeField() string { return i.fields[len(i.fields)-1] }
+
+// orderCursor is the position after the last order of a page, in index order
+type orderCursor struct {
+	time int64
+	key  string
+}
+
+// parseOrderCursor reads the cursor of a bookmark, nil for the first page
+func parseOrderCursor(bookmark string) (*orderCursor, error) {
+	if bookmark == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(bookmark, "\x00", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, newError(CodeInvalidArgument, "Invalid bookmark")
+	}
+	t, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, newError(CodeInvalidArgument, "Invalid bookmark")
+	}
+	return &orderCursor{time: t, key: parts[1]}, nil
+}
+
+// bookmark encodes the cursor as the bookmark of the next page
+func (cur *orderCursor) bookmark() string {
+	return encodeBookmark(strconv.FormatInt(cur.time, 10) + "\x00" + cur.key)
+}
+
+// index picks the index the query is sorted on, led by a field the selector fixes
+func (q *OrderQuery) index() orderIndex {
+	switch {
+	case q.Account != "" && q.Status == OrderSettled:
+		return orderIndex{"indexOrderFinished", []string{"account", "finishedTime"}}
+	case q.Account != "":
+		return orderIndex{"indexOrderAccount", []string{"account", "PendingTime"}}
+	case q.Status != "" && q.Status != OrderSettled:
+		return orderIndex{"indexOrderStatus", []string{"status", "PendingTime"}}
+	}
+	return orderIndex{"indexOrderPending", []string{"PendingTime"}}
+}
+
+// selector builds the CouchDB selector of the query for the orders after the cursor
+func (q *OrderQuery) selector(index orderIndex, cursor *orderCursor) map[string]interface{} {
+	and := []interface{}{
+		map[string]interface{}{"rawUUID": map[string]interface{}{"$exists": true}},
+		map[string]interface{}{index.fields[0]: map[string]interface{}{"$gt": nil}},
+	}
+	if cursor != nil {
+		// equal times are in key order in the index
+		and = append(and, map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{index.timeField(): map[string]interface{}{"$gt": cursor.time}},
+			map[string]interface{}{index.timeField(): cursor.time, "_id": map[string]interface{}{"$gt": cursor.key}},
+		}})
+	}
+	if q.Account != "" {
+		and = append(and, map[string]interface{}{"account": q.Account})
+	}
+	if q.Currency != "" {
+		and = append(and, map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"srcCurrency": q.Currency},
+			map[string]interface{}{"desCurrency": q.Currency},
+		}})
+	}
+
+	switch q.Status {
+	case "":
+	case OrderSettled:
+		and = append(and, map[string]interface{}{"status": map[string]interface{}{"$exists": false}})
+	default:
+		and = append(and, map[string]interface{}{"status": q.Status})
+	}
+
+	if q.From != 0 || q.To != 0 {
+		timeRange := map[string]interface{}{"$gte": q.From}
+		if q.To != 0 {
+			timeRange["$lte"] = q.To
+		}
+		switch q.Status {
+		case "":
+			and = append(and, map[string]interface{}{"$or": []interface{}{
+				map[string]interface{}{"status": map[string]interface{}{"$exists": false}, "finishedTime": timeRange},
+				map[string]interface{}{"status": map[string]interface{}{"$exists": true}, "PendingTime": timeRange},
+			}})
+		case OrderSettled:
+			and = append(and, map[string]interface{}{"finishedTime": timeRange})
+		default:
+			and = append(and, map[string]interface{}{"PendingTime": timeRange})
+		}
+	}
+
+	return map[string]interface{}{"$and": and}
+}
+
+// queryOrders returns the book orders and fills matching a query in the order of
+// the index it uses, oldest first.
+// Accounts see their own orders, auditors any account or all of them.
+// args: json{currency, account, from, to, status}, [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryOrders() pb.Response {
+	myLogger.Debug("queryOrders...")
+
+	q, err := parseOrderQuery([]byte(c.args[0]))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	auditor, err := c.hasRole(caller, RoleAuditor)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if q.Account == "" && !auditor {
+		q.Account = caller
+	}
+	if q.Account != caller && !auditor {
+		return errorResponse(newError(CodeUnauthorized, "The account [%s] does not have role [%s]", caller, RoleAuditor).
+			With("account", caller).With("role", RoleAuditor))
+	}
+
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+	cursor, err := parseOrderCursor(bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	index := q.index()
+	var sort []map[string]string
+	for _, field := range index.fields {
+		sort = append(sort, map[string]string{field: "asc"})
+	}
+
+	// read one more than the page to know whether there is a next page
+	query, err := json.Marshal(map[string]interface{}{
+		"selector":  q.selector(index, cursor),
+		"sort":      sort,
+		"limit":     pageSize + 1,
+		"use_index": []string{index.name + "Doc", index.name},
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	resultsIterator, err := c.stub.GetQueryResult(string(query))
+	if err != nil {
+		myLogger.Errorf("queryOrders error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed running rich query: [%s]", err))
+	}
+	defer resultsIterator.Close()
+
+	var keys []string
+	var bb [][]byte
+	for resultsIterator.HasNext() {
+		key, value, err := resultsIterator.Next()
+		if err != nil {
+			myLogger.Errorf("queryOrders error2:%s", err)
+			return errorResponse(err)
+		}
+		keys = append(keys, key)
+		bb = append(bb, value)
+	}
+
+	var orders []*Order
+	err = json.Unmarshal(joinJSON(bb), &orders)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	next := ""
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		last := orders[pageSize-1]
+		cursor = &orderCursor{time: last.PendingTime, key: keys[pageSize-1]}
+		if index.timeField() == "finishedTime" {
+			cursor.time = last.FinishedTime
+		}
+		next = cursor.bookmark()
+	}
+
+	payload, err := json.Marshal(&Page{Records: orders, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
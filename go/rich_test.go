@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+// lastQuery returns the sort and index of the last rich query
+func (e *testEnv) lastQuery() (fields []string, index []string, limit int) {
+	e.t.Helper()
+	var query struct {
+		Sort     []map[string]string `json:"sort"`
+		UseIndex []string            `json:"use_index"`
+		Limit    int                 `json:"limit"`
+	}
+	mustUnmarshal(e.t, []byte(e.queries[len(e.queries)-1]), &query)
+	for _, s := range query.Sort {
+		for field, dir := range s {
+			if dir != "asc" {
+				e.t.Fatalf("The query sorts %s %s", field, dir)
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, query.UseIndex, query.Limit
+}
+
+func TestQueryOrdersSortsOnTheIndexAndPagesThroughTies(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	type placed struct {
+		time int64
+		id   string
+	}
+	var expected []placed
+	for _, step := range []int64{0, 0, 1, 1, 1} {
+		e.now += step
+		expected = append(expected, placed{e.now, e.placeOrder("alice", "BTC", 1, "ETH", 2)})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].time < expected[j].time || (expected[i].time == expected[j].time && expected[i].id < expected[j].id)
+	})
+
+	var ids []string
+	bookmark := ""
+	for pages := 0; pages == 0 || bookmark != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("The pages don't end")
+		}
+		var orders []*Order
+		bookmark = pageOf(t, e.mustInvoke("alice", "queryOrders", "{}", "1", bookmark), &orders)
+		for _, order := range orders {
+			ids = append(ids, order.UUID)
+		}
+
+		fields, index, limit := e.lastQuery()
+		if len(fields) != 2 || fields[0] != "account" || fields[1] != "PendingTime" || index[1] != "indexOrderAccount" || limit != 2 {
+			t.Fatalf("The query is %s", e.queries[len(e.queries)-1])
+		}
+	}
+	if len(ids) != len(expected) {
+		t.Fatalf("queryOrders listed %v", ids)
+	}
+	for i, p := range expected {
+		if ids[i] != p.id {
+			t.Fatalf("queryOrders listed %v, expected %+v", ids, expected)
+		}
+	}
+
+	e.mustFail(CodeInvalidArgument, "alice", "queryOrders", "{}", "1", encodeBookmark("x"))
+}
+
+func TestQueryOrdersPicksAnIndexTheSelectorLeads(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustInvoke("admin", "grantRole", e.acct("aud"), string(RoleAuditor))
+
+	for _, c := range []struct {
+		who, query, index string
+	}{
+		{"alice", `{"status":"settled"}`, "indexOrderFinished"},
+		{"alice", `{"status":"open"}`, "indexOrderAccount"},
+		{"aud", `{"status":"open"}`, "indexOrderStatus"},
+		{"aud", `{"currency":"BTC"}`, "indexOrderPending"},
+		{"aud", `{"status":"settled"}`, "indexOrderPending"},
+	} {
+		e.mustInvoke(c.who, "queryOrders", c.query)
+		_, index, _ := e.lastQuery()
+		if len(index) != 2 || index[0] != c.index+"Doc" || index[1] != c.index {
+			t.Fatalf("%s queryOrders %s used %v, expected %s", c.who, c.query, index, c.index)
+		}
+	}
+}
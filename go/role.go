@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Role Role
+type Role string
+
+const (
+	RoleIssuer     = Role("issuer")
+	RoleOperator   = Role("operator")
+	RoleAdmin      = Role("admin")
+	RoleAuditor    = Role("auditor")
+	RoleCompliance = Role("compliance")
+)
+
+func (r Role) valid() bool {
+	switch r {
+	case RoleIssuer, RoleOperator, RoleAdmin, RoleAuditor, RoleCompliance:
+		return true
+	}
+	return false
+}
+
+// checkRole returns an error unless the account holds the role
+func (c *ExchangeChaincode) checkRole(account string, role Role) error {
+	ok, err := c.hasRole(account, role)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newError(CodeUnauthorized, "The account [%s] does not have role [%s]", account, role).
+			With("account", account).With("role", role)
+	}
+	return nil
+}
+
+// checkCallerRole returns an error unless the caller holds the role
+func (c *ExchangeChaincode) checkCallerRole(role Role) error {
+	caller, err := c.getCaller()
+	if err != nil {
+		return err
+	}
+	return c.checkRole(caller, role)
+}
+
+// grantRole grant a role to an account
+// args: account, role
+func (c *ExchangeChaincode) grantRole() pb.Response {
+	myLogger.Debug("Grant Role...")
+
+	account := c.args[0]
+	role := Role(c.args[1])
+	err := checkAccountID(account)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !role.valid() {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid role [%s]", role))
+	}
+
+	err = c.putRole(account, role)
+	if err != nil {
+		myLogger.Errorf("grantRole error1:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Grant Role...done")
+	return shim.Success(nil)
+}
+
+// revokeRole revoke a role from an account
+// args: account, role
+func (c *ExchangeChaincode) revokeRole() pb.Response {
+	myLogger.Debug("Revoke Role...")
+
+	caller, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	account := c.args[0]
+	role := Role(c.args[1])
+	if !role.valid() {
+		return errorResponse(newError(CodeInvalidArgument, "Invalid role [%s]", role))
+	}
+	if account == caller && role == RoleAdmin {
+		return errorResponse(newError(CodeInvalidArgument, "Admin can't revoke its own admin role"))
+	}
+
+	err = c.delRole(account, role)
+	if err != nil {
+		myLogger.Errorf("revokeRole error1:%s", err)
+		return errorResponse(err)
+	}
+
+	myLogger.Debug("Revoke Role...done")
+	return shim.Success(nil)
+}
+
+// checkCreator returns an error unless the caller created the currency
+func (c *ExchangeChaincode) checkCreator(curr *Currency) error {
+	caller, err := c.getCaller()
+	if err != nil {
+		return err
+	}
+	if caller != curr.Creator {
+		return newError(CodeUnauthorized, "Only the creator of currency [%s] can do this", curr.Name).
+			With("currency", curr.Name)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestInitBootstrapsAdminAndOperators(t *testing.T) {
+	e := newTestEnv(t)
+	for who, role := range map[string]Role{"admin": RoleAdmin, "op": RoleOperator, "iss": RoleIssuer} {
+		c := &ExchangeChaincode{stub: e.ms}
+		ok, err := c.hasRole(e.acct(who), role)
+		if err != nil || !ok {
+			t.Fatalf("%s doesn't have role %s: %v", who, role, err)
+		}
+	}
+}
+
+func TestInitOnlyBootstrapsTheFirstAdmin(t *testing.T) {
+	e := newTestEnv(t)
+
+	resp := e.call(true, "alice", "", e.acct("alice"))
+	cerr := new(CodeError)
+	if resp.Status == shim.OK || json.Unmarshal([]byte(resp.Message), cerr) != nil || cerr.Code != CodeUnauthorized {
+		t.Fatalf("Init by a non-admin returned %d %s", resp.Status, resp.Message)
+	}
+	e.mustFail(CodeUnauthorized, "alice", "grantRole", e.acct("alice"), string(RoleAdmin))
+
+	// an admin can upgrade and add operators
+	resp = e.call(true, "admin", "", e.acct("op2"))
+	if resp.Status != shim.OK {
+		t.Fatalf("Init by the admin failed: %s", resp.Message)
+	}
+	e.mustInvoke("op2", "queryMyLocks", e.acct("bob"))
+}
+
+func TestRolesGateFunctions(t *testing.T) {
+	e := newTestEnv(t)
+
+	// only an admin grants roles
+	e.mustFail(CodeUnauthorized, "alice", "grantRole", e.acct("alice"), string(RoleAdmin))
+	e.mustFail(CodeInvalidArgument, "admin", "grantRole", e.acct("alice"), "owner")
+	e.mustFail(CodeInvalidArgument, "admin", "grantRole", "alice", string(RoleIssuer))
+
+	// only an issuer creates currencies
+	e.mustFail(CodeUnauthorized, "alice", "create", `{"name":"LTC","count":100}`)
+	e.mustInvoke("admin", "grantRole", e.acct("alice"), string(RoleIssuer))
+	e.mustInvoke("alice", "create", `{"name":"LTC","count":100}`)
+	e.mustInvoke("admin", "revokeRole", e.acct("alice"), string(RoleIssuer))
+	e.mustFail(CodeUnauthorized, "alice", "create", `{"name":"XRP","count":100}`)
+
+	// only an operator settles and acts on behalf of users
+	e.mustFail(CodeUnauthorized, "alice", "exchange", `[]`)
+	e.mustFail(CodeUnauthorized, "alice", "queryMyLocks", e.acct("bob"))
+	e.mustInvoke("op", "queryMyLocks", e.acct("bob"))
+
+	// an admin can't lock itself out
+	e.mustFail(CodeInvalidArgument, "admin", "revokeRole", e.acct("admin"), string(RoleAdmin))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ParamType ParamType
+type ParamType string
+
+const (
+	StringParam = ParamType("string")
+	IntParam    = ParamType("int")
+	BoolParam   = ParamType("bool")
+	JSONParam   = ParamType("json")
+)
+
+// Param describes one argument of a function
+type Param struct {
+	Name     string    `json:"name"`
+	Type     ParamType `json:"type"`
+	Optional bool      `json:"optional,omitempty"`
+}
+
+// Function describes a function exposed through Invoke
+type Function struct {
+	Name     string  `json:"name"`
+	Params   []Param `json:"params"`
+	Role     Role    `json:"role,omitempty"`
+	ReadOnly bool    `json:"readOnly"`
+
+	handler func(c *ExchangeChaincode) pb.Response
+}
+
+var (
+	functions   []*Function
+	functionMap = make(map[string]*Function)
+)
+
+func register(f *Function) {
+	functions = append(functions, f)
+	functionMap[f.Name] = f
+}
+
+func init() {
+	register(&Function{Name: "initAccount", handler: (*ExchangeChaincode).initAccount,
+		Params: []Param{{Name: "user", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "create", handler: (*ExchangeChaincode).create,
+		Params: []Param{{Name: "definition", Type: JSONParam}, {Name: "creator", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "release", handler: (*ExchangeChaincode).release,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "count", Type: IntParam}}})
+	register(&Function{Name: "setCurrencyStatus", handler: (*ExchangeChaincode).setCurrencyStatus,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "status", Type: StringParam}, {Name: "reason", Type: StringParam}}})
+	register(&Function{Name: "burn", handler: (*ExchangeChaincode).burn,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "count", Type: IntParam}}})
+	register(&Function{Name: "redeem", handler: (*ExchangeChaincode).redeem,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "count", Type: IntParam}}})
+	register(&Function{Name: "assign", handler: (*ExchangeChaincode).assign,
+		Params: []Param{{Name: "assigns", Type: JSONParam}}})
+	register(&Function{Name: "transfer", handler: (*ExchangeChaincode).transfer,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "recipient", Type: StringParam},
+			{Name: "count", Type: IntParam}, {Name: "memo", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "approve", handler: (*ExchangeChaincode).approve,
+		Params: []Param{{Name: "spender", Type: StringParam}, {Name: "currency", Type: StringParam}, {Name: "amount", Type: IntParam}}})
+	register(&Function{Name: "transferFrom", handler: (*ExchangeChaincode).transferFrom,
+		Params: []Param{{Name: "owner", Type: StringParam}, {Name: "recipient", Type: StringParam}, {Name: "currency", Type: StringParam},
+			{Name: "count", Type: IntParam}, {Name: "memo", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "lock", handler: (*ExchangeChaincode).lock, Role: RoleOperator,
+		Params: []Param{{Name: "locks", Type: JSONParam}, {Name: "islock", Type: BoolParam}, {Name: "srcMethod", Type: StringParam}}})
+	register(&Function{Name: "exchange", handler: (*ExchangeChaincode).exchange, Role: RoleOperator,
+		Params: []Param{{Name: "orders", Type: JSONParam}}})
+	register(&Function{Name: "placeOrder", handler: (*ExchangeChaincode).placeOrder,
+		Params: []Param{{Name: "order", Type: JSONParam}, {Name: "account", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "cancelOrder", handler: (*ExchangeChaincode).cancelOrder,
+		Params: []Param{{Name: "orderId", Type: StringParam}}})
+	register(&Function{Name: "match", handler: (*ExchangeChaincode).match, Role: RoleOperator,
+		Params: []Param{{Name: "srcCurrency", Type: StringParam}, {Name: "desCurrency", Type: StringParam}, {Name: "maxFills", Type: IntParam, Optional: true}}})
+	register(&Function{Name: "releaseExpiredLocks", handler: (*ExchangeChaincode).releaseExpiredLocks})
+	register(&Function{Name: "sweepExpired", handler: (*ExchangeChaincode).sweepExpired,
+		Params: []Param{{Name: "orders", Type: JSONParam, Optional: true}}})
+	register(&Function{Name: "setFeeSchedule", handler: (*ExchangeChaincode).setFeeSchedule, Role: RoleAdmin,
+		Params: []Param{{Name: "schedule", Type: JSONParam}}})
+	register(&Function{Name: "setFeeCollector", handler: (*ExchangeChaincode).setFeeCollector, Role: RoleAdmin,
+		Params: []Param{{Name: "account", Type: StringParam}}})
+	register(&Function{Name: "setAccountStatus", handler: (*ExchangeChaincode).setAccountStatus, Role: RoleAdmin,
+		Params: []Param{{Name: "account", Type: StringParam}, {Name: "status", Type: StringParam}, {Name: "reason", Type: StringParam}}})
+	register(&Function{Name: "setAccountTier", handler: (*ExchangeChaincode).setAccountTier, Role: RoleCompliance,
+		Params: []Param{{Name: "account", Type: StringParam}, {Name: "tier", Type: IntParam}}})
+	register(&Function{Name: "setTierLimit", handler: (*ExchangeChaincode).setTierLimit, Role: RoleCompliance,
+		Params: []Param{{Name: "limit", Type: JSONParam}}})
+	register(&Function{Name: "grantRole", handler: (*ExchangeChaincode).grantRole, Role: RoleAdmin,
+		Params: []Param{{Name: "account", Type: StringParam}, {Name: "role", Type: StringParam}}})
+	register(&Function{Name: "revokeRole", handler: (*ExchangeChaincode).revokeRole, Role: RoleAdmin,
+		Params: []Param{{Name: "account", Type: StringParam}, {Name: "role", Type: StringParam}}})
+
+	register(&Function{Name: "queryCurrencyByID", handler: (*ExchangeChaincode).queryCurrencyByID, ReadOnly: true,
+		Params: []Param{{Name: "currency", Type: StringParam}}})
+	register(&Function{Name: "queryAllCurrency", handler: (*ExchangeChaincode).queryAllCurrency, ReadOnly: true,
+		Params: pagingParams})
+	register(&Function{Name: "queryTxLogs", handler: (*ExchangeChaincode).queryTxLogs, ReadOnly: true,
+		Params: pagingParams})
+	register(&Function{Name: "queryAssetByOwner", handler: (*ExchangeChaincode).queryAssetByOwner, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam}}, pagingParams...)})
+	register(&Function{Name: "queryAssetHistory", handler: (*ExchangeChaincode).queryAssetHistory, ReadOnly: true,
+		Params: append([]Param{{Name: "currency", Type: StringParam}, {Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "balanceAt", handler: (*ExchangeChaincode).balanceAt, ReadOnly: true,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "timestamp", Type: IntParam}, {Name: "owner", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "queryMyCurrency", handler: (*ExchangeChaincode).queryMyCurrency, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryMyReleaseLog", handler: (*ExchangeChaincode).queryMyReleaseLog, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryCurrencyStatusLog", handler: (*ExchangeChaincode).queryCurrencyStatusLog, ReadOnly: true,
+		Params: append([]Param{{Name: "currency", Type: StringParam}}, pagingParams...)})
+	register(&Function{Name: "queryAccountStatus", handler: (*ExchangeChaincode).queryAccountStatus, ReadOnly: true,
+		Params: append([]Param{{Name: "account", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryTierLimit", handler: (*ExchangeChaincode).queryTierLimit, ReadOnly: true,
+		Params: []Param{{Name: "currency", Type: StringParam}, {Name: "tier", Type: IntParam}}})
+	register(&Function{Name: "queryMyBurnLog", handler: (*ExchangeChaincode).queryMyBurnLog, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryMyRedeemLog", handler: (*ExchangeChaincode).queryMyRedeemLog, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryMyAssignLog", handler: (*ExchangeChaincode).queryMyAssignLog, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryOrderBook", handler: (*ExchangeChaincode).queryOrderBook, ReadOnly: true,
+		Params: append([]Param{{Name: "srcCurrency", Type: StringParam}, {Name: "desCurrency", Type: StringParam}}, pagingParams...)})
+	register(&Function{Name: "queryOrderStatus", handler: (*ExchangeChaincode).queryOrderStatus, ReadOnly: true,
+		Params: []Param{{Name: "orderId", Type: StringParam}}})
+	register(&Function{Name: "queryMyTransferLog", handler: (*ExchangeChaincode).queryMyTransferLog, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryOrders", handler: (*ExchangeChaincode).queryOrders, ReadOnly: true,
+		Params: append([]Param{{Name: "query", Type: JSONParam}}, pagingParams...)})
+	register(&Function{Name: "queryMyTrades", handler: (*ExchangeChaincode).queryMyTrades, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}, {Name: "filter", Type: JSONParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryAllowance", handler: (*ExchangeChaincode).queryAllowance, ReadOnly: true,
+		Params: []Param{{Name: "owner", Type: StringParam}, {Name: "spender", Type: StringParam}, {Name: "currency", Type: StringParam}}})
+	register(&Function{Name: "queryMyLocks", handler: (*ExchangeChaincode).queryMyLocks, ReadOnly: true,
+		Params: append([]Param{{Name: "owner", Type: StringParam, Optional: true}}, pagingParams...)})
+	register(&Function{Name: "queryFeeSchedule", handler: (*ExchangeChaincode).queryFeeSchedule, ReadOnly: true,
+		Params: []Param{{Name: "srcCurrency", Type: StringParam}, {Name: "desCurrency", Type: StringParam}}})
+	register(&Function{Name: "queryFeeReport", handler: (*ExchangeChaincode).queryFeeReport, ReadOnly: true,
+		Params: []Param{{Name: "currency", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "auditSupply", handler: (*ExchangeChaincode).auditSupply, Role: RoleAuditor, ReadOnly: true,
+		Params: []Param{{Name: "currency", Type: StringParam, Optional: true}}})
+	register(&Function{Name: "listFunctions", handler: (*ExchangeChaincode).listFunctions, ReadOnly: true})
+}
+
+// pagingParams are the trailing params of list queries
+var pagingParams = []Param{{Name: "pageSize", Type: IntParam, Optional: true}, {Name: "bookmark", Type: StringParam, Optional: true}}
+
+// checkArgs validates the arguments against the function's params
+func (f *Function) checkArgs(args []string) error {
+	required := 0
+	for _, p := range f.Params {
+		if !p.Optional {
+			required++
+		}
+	}
+
+	if len(args) < required || len(args) > len(f.Params) {
+		if required == len(f.Params) {
+			return newError(CodeInvalidArgument, "Incorrect number of arguments. Expecting %d", required).
+				With("expected", required).With("actual", len(args))
+		}
+		return newError(CodeInvalidArgument, "Incorrect number of arguments. Expecting %d to %d", required, len(f.Params)).
+			With("expected", fmt.Sprintf("%d-%d", required, len(f.Params))).With("actual", len(args))
+	}
+
+	for i, arg := range args {
+		p := f.Params[i]
+		if p.Optional && arg == "" {
+			continue
+		}
+
+		var err error
+		switch p.Type {
+		case IntParam:
+			_, err = strconv.ParseInt(arg, 10, 64)
+		case BoolParam:
+			_, err = strconv.ParseBool(arg)
+		case JSONParam:
+			var v interface{}
+			err = json.Unmarshal([]byte(arg), &v)
+		}
+		if err != nil {
+			return newError(CodeInvalidArgument, "Invalid argument [%s]. Expecting %s", p.Name, p.Type).
+				With("param", p.Name).With("type", p.Type)
+		}
+	}
+
+	return nil
+}
+
+// route dispatches the function to its handler after checking arguments and role
+func (c *ExchangeChaincode) route(function string) pb.Response {
+	f, ok := functionMap[function]
+	if !ok {
+		return errorResponse(newError(CodeUnknownFunction, "Invalid invoke function name [%s]", function).With("function", function))
+	}
+
+	err := f.checkArgs(c.args)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if f.Role != "" {
+		err = c.checkCallerRole(f.Role)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	return f.handler(c)
+}
+
+// listFunctions returns the functions exposed by the chaincode
+func (c *ExchangeChaincode) listFunctions() pb.Response {
+	myLogger.Debug("listFunctions...")
+
+	payload, err := json.Marshal(functions)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestListFunctionsDescribesTheRoutes(t *testing.T) {
+	e := newTestEnv(t)
+
+	var list []*Function
+	mustUnmarshal(t, e.mustInvoke("alice", "listFunctions"), &list)
+	if len(list) != len(functionMap) {
+		t.Fatalf("listFunctions returned %d functions, %d are registered", len(list), len(functionMap))
+	}
+	for _, f := range list {
+		if functionMap[f.Name] == nil {
+			t.Fatalf("listFunctions returned the unknown function %s", f.Name)
+		}
+		if f.Name == "transfer" && (len(f.Params) != 4 || f.Params[2].Type != IntParam || !f.Params[3].Optional) {
+			t.Fatalf("The params of transfer are %+v", f.Params)
+		}
+		if f.Name == "exchange" && f.Role != RoleOperator {
+			t.Fatalf("exchange needs role %q", f.Role)
+		}
+	}
+}
+
+func TestRouteRejectsUnknownFunctionsAndBadArgs(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 10)
+
+	e.mustFail(CodeUnknownFunction, "alice", "mint", "BTC", "10")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC", e.acct("bob"), "1", "memo", "extra")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC", e.acct("bob"), "ten")
+	e.mustFail(CodeInvalidArgument, "op", "exchange", "{not json")
+
+	// an empty optional arg is not checked against its type
+	e.mustInvoke("alice", "queryMyLocks", "", "")
+
+	resp := e.invoke("alice", "transfer", "BTC")
+	cerr := new(CodeError)
+	err := json.Unmarshal([]byte(resp.Message), cerr)
+	if err != nil || cerr.Details["expected"] != "3-4" || cerr.Details["actual"] != float64(1) {
+		t.Fatalf("The error is %s", resp.Message)
+	}
+	e.checkBalance("alice", "BTC", 10, 0)
+}
@@ -2,26 +2,69 @@ package main
 
 import (
 	"encoding/json"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 var NilValue = []byte{0x00}
 
+// getState reads a key, seeing the writes made earlier in this transaction
+// which the peer only returns once they are committed
+func (c *ExchangeChaincode) getState(key string) ([]byte, error) {
+	if v, ok := c.writes[key]; ok {
+		return v, nil
+	}
+	return c.stub.GetState(key)
+}
+
+// putState writes a key and remembers the value for the rest of the transaction
+func (c *ExchangeChaincode) putState(key string, value []byte) error {
+	err := c.stub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	c.cacheWrite(key, value)
+	return nil
+}
+
+// delState deletes a key and remembers the deletion for the rest of the transaction
+func (c *ExchangeChaincode) delState(key string) error {
+	err := c.stub.DelState(key)
+	if err != nil {
+		return err
+	}
+	c.cacheWrite(key, nil)
+	return nil
+}
+
+func (c *ExchangeChaincode) cacheWrite(key string, value []byte) {
+	if c.writes == nil {
+		c.writes = make(map[string][]byte)
+	}
+	c.writes[key] = value
+}
+
 func (c *ExchangeChaincode) putCompositeValue(indexName string, compositeValue []string) error {
 	indexKey, err := c.stub.CreateCompositeKey(indexName, compositeValue)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(indexKey, NilValue)
+	err = c.putState(indexKey, NilValue)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *ExchangeChaincode) getCompositeValue(indexName string, compositeValue []string, keyIndex int) ([][]byte, error) {
-	var bb [][]byte
+// getCompositeKeys returns the index keys matching the partial key in key order,
+// merging the committed keys with those written or deleted in this transaction
+func (c *ExchangeChaincode) getCompositeKeys(indexName string, compositeValue []string) ([]string, error) {
+	prefix, err := c.stub.CreateCompositeKey(indexName, compositeValue)
+	if err != nil {
+		return nil, err
+	}
 
 	resultsIterator, err := c.stub.GetStateByPartialCompositeKey(indexName, compositeValue)
 	if err != nil {
@@ -29,19 +72,44 @@ func (c *ExchangeChaincode) getCompositeValue(indexName string, compositeValue [
 	}
 	defer resultsIterator.Close()
 
+	var keys []string
 	for resultsIterator.HasNext() {
 		compositeKey, _, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := c.writes[compositeKey]; ok {
+			continue
+		}
+		keys = append(keys, compositeKey)
+	}
+
+	for k, v := range c.writes {
+		if len(v) > 0 && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (c *ExchangeChaincode) getCompositeValue(indexName string, compositeValue []string, keyIndex int) ([][]byte, error) {
+	var bb [][]byte
+
+	keys, err := c.getCompositeKeys(indexName, compositeValue)
+	if err != nil {
+		return nil, err
+	}
 
+	for _, compositeKey := range keys {
 		_, compositeKeyParts, err := c.stub.SplitCompositeKey(compositeKey)
 		if err != nil {
 			return nil, err
 		}
 
 		key := compositeKeyParts[keyIndex]
-		b, err := c.stub.GetState(key)
+		b, err := c.getState(key)
 		if err != nil {
 			return nil, err
 		}
@@ -51,25 +119,73 @@ func (c *ExchangeChaincode) getCompositeValue(indexName string, compositeValue [
 	return bb, nil
 }
 
+// putRole putRole
+func (c *ExchangeChaincode) putRole(account string, role Role) error {
+	return c.putCompositeValue("Role~account~role", []string{account, string(role)})
+}
+
+// delRole delRole
+func (c *ExchangeChaincode) delRole(account string, role Role) error {
+	key, err := c.stub.CreateCompositeKey("Role~account~role", []string{account, string(role)})
+	if err != nil {
+		return err
+	}
+	return c.delState(key)
+}
+
+// hasRole hasRole
+func (c *ExchangeChaincode) hasRole(account string, role Role) (bool, error) {
+	key, err := c.stub.CreateCompositeKey("Role~account~role", []string{account, string(role)})
+	if err != nil {
+		return false, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return false, err
+	}
+	return len(b) > 0, nil
+}
+
+// hasAdmin reports whether any account holds the admin role
+func (c *ExchangeChaincode) hasAdmin() (bool, error) {
+	keys, err := c.getCompositeKeys("Role~account~role", []string{})
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return false, err
+		}
+		if len(parts) == 2 && Role(parts[1]) == RoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Asset Asset
 type Asset struct {
-	UUID      string `json:"uuid"`
-	Owner     string `json:"owner"`
-	Currency  string `json:"currency"`
-	Count     int64  `json:"count"`
-	LockCount int64  `json:"lockCount"`
+	UUID       string `json:"uuid"`
+	Owner      string `json:"owner"`
+	Currency   string `json:"currency"`
+	Count      int64  `json:"count"`
+	LockCount  int64  `json:"lockCount"`
+	UpdateTime int64  `json:"updateTime"`
 }
 
 func (c *ExchangeChaincode) putAsset(asset *Asset) error {
 	if asset.UUID == "" {
-		asset.UUID = GenerateUUID()
+		asset.UUID = c.newUUID()
 	}
+	asset.UpdateTime = c.now
 	r, err := json.Marshal(asset)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(asset.UUID, r)
+	err = c.putState(asset.UUID, r)
 	if err != nil {
 		return err
 	}
@@ -84,16 +200,24 @@ func (c *ExchangeChaincode) putAsset(asset *Asset) error {
 		return err
 	}
 
+	err = c.putCompositeValue("Asset~currency~owner~uuid", []string{asset.Currency, asset.Owner, asset.UUID})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (c *ExchangeChaincode) getAsset(key string) (*Asset, error) {
-	assetByte, err := c.stub.GetState(key)
+	assetByte, err := c.getState(key)
 	if err != nil {
 		return nil, err
 	}
+	if len(assetByte) == 0 {
+		return nil, nil
+	}
 
-	var asset *Asset
+	asset := new(Asset)
 	err = json.Unmarshal(assetByte, asset)
 	if err != nil {
 		return nil, err
@@ -107,8 +231,11 @@ func (c *ExchangeChaincode) getOwnerOneAsset(owner, currency string) (*Asset, er
 	if err != nil {
 		return nil, err
 	}
+	if len(bb) == 0 {
+		return nil, nil
+	}
 
-	var asset *Asset
+	asset := new(Asset)
 	err = json.Unmarshal(bb[0], asset)
 	if err != nil {
 		return nil, err
@@ -125,7 +252,7 @@ func (c *ExchangeChaincode) getOwnerAllAsset(owner string) ([]*Asset, error) {
 
 	var assets []*Asset
 	for _, v := range bb {
-		var asset *Asset
+		asset := new(Asset)
 		err = json.Unmarshal(v, asset)
 		if err != nil {
 			return nil, err
@@ -136,6 +263,144 @@ func (c *ExchangeChaincode) getOwnerAllAsset(owner string) ([]*Asset, error) {
 	return assets, nil
 }
 
+type AccountInfo struct {
+	Owner      string `json:"owner"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	Operator   string `json:"operator,omitempty"`
+	Tier       int    `json:"tier"`
+	UpdateTime int64  `json:"updateTime"`
+}
+
+// putAccountInfo putAccountInfo
+func (c *ExchangeChaincode) putAccountInfo(info *AccountInfo) error {
+	key, err := c.stub.CreateCompositeKey("Account~owner", []string{info.Owner})
+	if err != nil {
+		return err
+	}
+
+	info.UpdateTime = c.now
+	r, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return c.putState(key, r)
+}
+
+// getAccountInfo returns an active account when the owner is not in the registry
+func (c *ExchangeChaincode) getAccountInfo(owner string) (*AccountInfo, error) {
+	key, err := c.stub.CreateCompositeKey("Account~owner", []string{owner})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &AccountInfo{Owner: owner, Status: AccountActive}
+	if len(b) == 0 {
+		return info, nil
+	}
+	err = json.Unmarshal(b, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// putTierLimit putTierLimit
+func (c *ExchangeChaincode) putTierLimit(limit *TierLimit) error {
+	key, err := c.stub.CreateCompositeKey("TierLimit~currency~tier", []string{limit.Currency, strconv.Itoa(limit.Tier)})
+	if err != nil {
+		return err
+	}
+
+	r, err := json.Marshal(limit)
+	if err != nil {
+		return err
+	}
+	return c.putState(key, r)
+}
+
+// getTierLimit getTierLimit
+func (c *ExchangeChaincode) getTierLimit(currency string, tier int) (*TierLimit, error) {
+	key, err := c.stub.CreateCompositeKey("TierLimit~currency~tier", []string{currency, strconv.Itoa(tier)})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	limit := new(TierLimit)
+	err = json.Unmarshal(b, limit)
+	if err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+// putDailyVolume putDailyVolume
+func (c *ExchangeChaincode) putDailyVolume(owner, currency string, day, volume int64) error {
+	key, err := c.stub.CreateCompositeKey("DailyVolume~owner~currency~day", []string{owner, currency, strconv.FormatInt(day, 10)})
+	if err != nil {
+		return err
+	}
+	return c.putState(key, []byte(strconv.FormatInt(volume, 10)))
+}
+
+// getDailyVolume getDailyVolume
+func (c *ExchangeChaincode) getDailyVolume(owner, currency string, day int64) (int64, error) {
+	key, err := c.stub.CreateCompositeKey("DailyVolume~owner~currency~day", []string{owner, currency, strconv.FormatInt(day, 10)})
+	if err != nil {
+		return 0, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+type AccountStatusLog struct {
+	UUID       string `json:"uuid"`
+	Owner      string `json:"owner"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Reason     string `json:"reason"`
+	Operator   string `json:"operator"`
+	ChangeTime int64  `json:"changeTime"`
+}
+
+// putAccountStatusLog
+func (c *ExchangeChaincode) putAccountStatusLog(log *AccountStatusLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
+	}
+
+	return c.putCompositeValue("AccountStatusLog~owner~uuid", []string{log.Owner, log.UUID})
+}
+
 // Currency Currency
 type Currency struct {
 	UUID       string `json:"uuid"`
@@ -144,19 +409,28 @@ type Currency struct {
 	LeftCount  int64  `json:"leftCount"`
 	Creator    string `json:"creator"`
 	CreateTime int64  `json:"createTime"`
+
+	DisplayName   string `json:"displayName,omitempty"`
+	Symbol        string `json:"symbol,omitempty"`
+	Decimals      int    `json:"decimals"`
+	MaxSupply     int64  `json:"maxSupply,omitempty"`
+	Description   string `json:"description,omitempty"`
+	IssuerContact string `json:"issuerContact,omitempty"`
+	Status        string `json:"status,omitempty"`
+	StatusAdmin   bool   `json:"statusAdmin,omitempty"` // the status was set by an admin
 }
 
 // putCurrency putCurrency
 func (c *ExchangeChaincode) putCurrency(currency *Currency) error {
 	if currency.UUID == "" {
-		currency.UUID = GenerateUUID()
+		currency.UUID = c.newUUID()
 	}
 	r, err := json.Marshal(currency)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(currency.UUID, r)
+	err = c.putState(currency.UUID, r)
 	if err != nil {
 		return err
 	}
@@ -179,12 +453,15 @@ func (c *ExchangeChaincode) putCurrency(currency *Currency) error {
 }
 
 func (c *ExchangeChaincode) getCurrency(key string) (*Currency, error) {
-	currByte, err := c.stub.GetState(key)
+	currByte, err := c.getState(key)
 	if err != nil {
 		return nil, err
 	}
+	if len(currByte) == 0 {
+		return nil, nil
+	}
 
-	var curr *Currency
+	curr := new(Currency)
 	err = json.Unmarshal(currByte, curr)
 	if err != nil {
 		return nil, err
@@ -198,7 +475,11 @@ func (c *ExchangeChaincode) getCurrencyByName(name string) (*Currency, error) {
 	if err != nil {
 		return nil, err
 	}
-	var curr *Currency
+	if len(bb) == 0 {
+		return nil, nil
+	}
+
+	curr := new(Currency)
 	err = json.Unmarshal(bb[0], curr)
 	if err != nil {
 		return nil, err
@@ -215,7 +496,7 @@ func (c *ExchangeChaincode) getAllCurrency() ([]*Currency, error) {
 
 	var currs []*Currency
 	for _, v := range bb {
-		var curr *Currency
+		curr := new(Currency)
 		err = json.Unmarshal(v, curr)
 		if err != nil {
 			return nil, err
@@ -227,31 +508,38 @@ func (c *ExchangeChaincode) getAllCurrency() ([]*Currency, error) {
 	return currs, nil
 }
 
-// getMyCurrency
-func (c *ExchangeChaincode) getMyCurrency(owner string) ([]*Currency, error) {
-	bb, err := c.getCompositeValue("Currency~owner~uuid", []string{owner}, 1)
+type CurrencyStatusLog struct {
+	UUID       string `json:"uuid"`
+	Currency   string `json:"currency"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Reason     string `json:"reason"`
+	Operator   string `json:"operator"`
+	ChangeTime int64  `json:"changeTime"`
+}
+
+// putCurrencyStatusLog
+func (c *ExchangeChaincode) putCurrencyStatusLog(log *CurrencyStatusLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var currs []*Currency
-	for _, v := range bb {
-		var curr *Currency
-		err = json.Unmarshal(v, curr)
-		if err != nil {
-			return nil, err
-		}
-
-		currs = append(currs, curr)
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
 	}
 
-	return currs, nil
+	return c.putCompositeValue("CurrencyStatusLog~currency~uuid", []string{log.Currency, log.UUID})
 }
 
 type ReleaseLog struct {
 	UUID        string `json:"uuid"`
 	Currency    string `json:"currency"`
-	Releaser    string `json:"releaser`
+	Releaser    string `json:"releaser"`
 	Count       int64  `json:"cont"`
 	ReleaseTime int64  `json:"releaseTime"`
 }
@@ -259,14 +547,14 @@ type ReleaseLog struct {
 // saveReleaseLog
 func (c *ExchangeChaincode) putReleaseLog(log *ReleaseLog) error {
 	if log.UUID == "" {
-		log.UUID = GenerateUUID()
+		log.UUID = c.newUUID()
 	}
 	r, err := json.Marshal(log)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(log.UUID, r)
+	err = c.putState(log.UUID, r)
 	if err != nil {
 		return err
 	}
@@ -279,12 +567,15 @@ func (c *ExchangeChaincode) putReleaseLog(log *ReleaseLog) error {
 }
 
 func (c *ExchangeChaincode) getReleaseLog(key string) (*ReleaseLog, error) {
-	logByte, err := c.stub.GetState(key)
+	logByte, err := c.getState(key)
 	if err != nil {
 		return nil, err
 	}
+	if len(logByte) == 0 {
+		return nil, nil
+	}
 
-	var log *ReleaseLog
+	log := new(ReleaseLog)
 	err = json.Unmarshal(logByte, log)
 	if err != nil {
 		return nil, err
@@ -292,24 +583,64 @@ func (c *ExchangeChaincode) getReleaseLog(key string) (*ReleaseLog, error) {
 	return log, nil
 }
 
-func (c *ExchangeChaincode) getMyReleaseLog(owner string) ([]*ReleaseLog, error) {
-	bb, err := c.getCompositeValue("ReleaseLog~owner~uuid", []string{owner}, 1)
+type BurnLog struct {
+	UUID     string `json:"uuid"`
+	Currency string `json:"currency"`
+	Burner   string `json:"burner"`
+	Count    int64  `json:"count"`
+	BurnTime int64  `json:"burnTime"`
+}
+
+// putBurnLog
+func (c *ExchangeChaincode) putBurnLog(log *BurnLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var logs []*ReleaseLog
-	for _, v := range bb {
-		var log *ReleaseLog
-		err = json.Unmarshal(v, log)
-		if err != nil {
-			return nil, err
-		}
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
+	}
 
-		logs = append(logs, log)
+	err = c.putCompositeValue("BurnLog~owner~uuid", []string{log.Burner, log.UUID})
+	if err != nil {
+		return err
 	}
+	return nil
+}
 
-	return logs, nil
+type RedeemLog struct {
+	UUID       string `json:"uuid"`
+	Currency   string `json:"currency"`
+	Redeemer   string `json:"redeemer"`
+	Count      int64  `json:"count"`
+	RedeemTime int64  `json:"redeemTime"`
+}
+
+// putRedeemLog
+func (c *ExchangeChaincode) putRedeemLog(log *RedeemLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
+	}
+
+	err = c.putCompositeValue("RedeemLog~owner~uuid", []string{log.Redeemer, log.UUID})
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
 type AssignLog struct {
@@ -324,14 +655,14 @@ type AssignLog struct {
 // saveAssignLog
 func (c *ExchangeChaincode) putAssignLog(log *AssignLog) error {
 	if log.UUID == "" {
-		log.UUID = GenerateUUID()
+		log.UUID = c.newUUID()
 	}
 	r, err := json.Marshal(log)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(log.UUID, r)
+	err = c.putState(log.UUID, r)
 	if err != nil {
 		return err
 	}
@@ -348,100 +679,261 @@ func (c *ExchangeChaincode) putAssignLog(log *AssignLog) error {
 	return nil
 }
 
-func (c *ExchangeChaincode) getFromAssignLog(owner string) ([]*AssignLog, error) {
-	bb, err := c.getCompositeValue("AssignLog~from~uuid", []string{owner}, 1)
+type TransferLog struct {
+	UUID         string `json:"uuid"`
+	Currency     string `json:"currency"`
+	FromUser     string `json:"fromUser"`
+	ToUser       string `json:"toUser"`
+	Count        int64  `json:"count"`
+	Memo         string `json:"memo,omitempty"`
+	Spender      string `json:"spender,omitempty"`
+	TransferTime int64  `json:"transferTime"`
+}
+
+// putTransferLog
+func (c *ExchangeChaincode) putTransferLog(log *TransferLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var logs []*AssignLog
-	for _, v := range bb {
-		var log *AssignLog
-		err = json.Unmarshal(v, log)
-		if err != nil {
-			return nil, err
-		}
-
-		logs = append(logs, log)
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
 	}
-	return logs, nil
-}
 
-func (c *ExchangeChaincode) getToAssignLog(owner string) ([]*AssignLog, error) {
-	bb, err := c.getCompositeValue("AssignLog~to~uuid", []string{owner}, 1)
+	err = c.putCompositeValue("TransferLog~from~uuid", []string{log.FromUser, log.UUID})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var logs []*AssignLog
-	for _, v := range bb {
-		var log *AssignLog
-		err = json.Unmarshal(v, log)
-		if err != nil {
-			return nil, err
-		}
-
-		logs = append(logs, log)
+	err = c.putCompositeValue("TransferLog~to~uuid", []string{log.ToUser, log.UUID})
+	if err != nil {
+		return err
 	}
-	return logs, nil
+	return nil
 }
 
-type LockLog struct {
-	UUID      string `json:"uuid"`
-	Owner     string `json:"owner"`
-	Currency  string `json:"currency"`
-	Order     string `json:"order"`
-	IsLock    bool   `json:"isLock"`
-	LockCount int64  `json:"lockCount"`
-	LockTime  int64  `json:"lockTime"`
+type Allowance struct {
+	Owner      string `json:"owner"`
+	Spender    string `json:"spender"`
+	Currency   string `json:"currency"`
+	Amount     int64  `json:"amount"`
+	UpdateTime int64  `json:"updateTime"`
 }
 
-func (c *ExchangeChaincode) putLockLog(log *LockLog) error {
-	if log.UUID == "" {
-		log.UUID = GenerateUUID()
-	}
-	r, err := json.Marshal(log)
+// putAllowance stores the allowance, an allowance of 0 is deleted
+func (c *ExchangeChaincode) putAllowance(allowance *Allowance) error {
+	key, err := c.stub.CreateCompositeKey("Allowance~owner~spender~currency", []string{allowance.Owner, allowance.Spender, allowance.Currency})
 	if err != nil {
 		return err
 	}
+	allowance.UpdateTime = c.now
+	if allowance.Amount == 0 {
+		return c.delState(key)
+	}
 
-	err = c.stub.PutState(log.UUID, r)
+	r, err := json.Marshal(allowance)
 	if err != nil {
 		return err
 	}
+	return c.putState(key, r)
+}
 
-	err = c.putCompositeValue("LockLog~owner~curr~order~islock~uuid", []string{log.Owner, log.Currency, log.Order, strconv.FormatBool(log.IsLock), log.UUID})
+// getAllowance returns a zero allowance when none is approved
+func (c *ExchangeChaincode) getAllowance(owner, spender, currency string) (*Allowance, error) {
+	key, err := c.stub.CreateCompositeKey("Allowance~owner~spender~currency", []string{owner, spender, currency})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
-
-// getLockLog getLockLog
-func (c *ExchangeChaincode) getLockLog(key string) (*LockLog, error) {
-	logByte, err := c.stub.GetState(key)
+	b, err := c.getState(key)
 	if err != nil {
 		return nil, err
 	}
 
-	var log *LockLog
-	err = json.Unmarshal(logByte, logByte)
+	allowance := &Allowance{Owner: owner, Spender: spender, Currency: currency}
+	if len(b) == 0 {
+		return allowance, nil
+	}
+	err = json.Unmarshal(b, allowance)
 	if err != nil {
 		return nil, err
 	}
-	return log, nil
+	return allowance, nil
 }
 
-// getLockLog getLockLog
+// getAssignLog getAssignLog
+func (c *ExchangeChaincode) getAssignLog(key string) (*AssignLog, error) {
+	logByte, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(logByte) == 0 {
+		return nil, nil
+	}
+
+	log := new(AssignLog)
+	err = json.Unmarshal(logByte, log)
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// getTransferLog getTransferLog
+func (c *ExchangeChaincode) getTransferLog(key string) (*TransferLog, error) {
+	logByte, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(logByte) == 0 {
+		return nil, nil
+	}
+
+	log := new(TransferLog)
+	err = json.Unmarshal(logByte, log)
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// OrderLimit is the limit of the order a lock funds: the locked count pays for
+// at least DesCount of DesCurrency, until ExpiredTime when it is set
+type OrderLimit struct {
+	DesCurrency string `json:"desCurrency"`
+	DesCount    int64  `json:"desCount"`
+	ExpiredTime int64  `json:"expiredTime,omitempty"`
+}
+
+type LockLog struct {
+	UUID       string `json:"uuid"`
+	Owner      string `json:"owner"`
+	Currency   string `json:"currency"`
+	Order      string `json:"order"`
+	IsLock     bool   `json:"isLock"`
+	LockCount  int64  `json:"lockCount"`
+	LockTime   int64  `json:"lockTime"`
+	ExpireTime int64  `json:"expireTime,omitempty"`
+	*OrderLimit
+}
+
+func (c *ExchangeChaincode) putLockLog(log *LockLog) error {
+	if log.UUID == "" {
+		log.UUID = c.newUUID()
+	}
+	r, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+
+	err = c.putState(log.UUID, r)
+	if err != nil {
+		return err
+	}
+
+	err = c.putCompositeValue("LockLog~owner~curr~order~islock~uuid", []string{log.Owner, log.Currency, log.Order, strconv.FormatBool(log.IsLock), log.UUID})
+	if err != nil {
+		return err
+	}
+
+	if log.IsLock && log.ExpireTime != 0 {
+		err = c.putCompositeValue("LockExpire~time~uuid", []string{timeKey(log.ExpireTime), log.UUID})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// delLockExpiry takes a closed lock out of the expiry index
+func (c *ExchangeChaincode) delLockExpiry(log *LockLog) error {
+	if log.ExpireTime == 0 {
+		return nil
+	}
+	key, err := c.stub.CreateCompositeKey("LockExpire~time~uuid", []string{timeKey(log.ExpireTime), log.UUID})
+	if err != nil {
+		return err
+	}
+	return c.delState(key)
+}
+
+// getExpiredLocks returns up to max open locks whose ttl ended before now, by expiry.
+// It reads at most max entries of the expiry index.
+func (c *ExchangeChaincode) getExpiredLocks(now int64, max int) ([]*LockLog, error) {
+	startKey, err := c.stub.CreateCompositeKey("LockExpire~time~uuid", nil)
+	if err != nil {
+		return nil, err
+	}
+	endKey, err := c.stub.CreateCompositeKey("LockExpire~time~uuid", []string{timeKey(now)})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := c.stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var logs []*LockLog
+	for read := 0; read < max && resultsIterator.HasNext(); read++ {
+		key, _, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		log, err := c.getLockLog(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if log != nil && log.isExpired(now) {
+			logs = append(logs, log)
+		}
+	}
+
+	return logs, nil
+}
+
+// getLockLog getLockLog
+func (c *ExchangeChaincode) getLockLog(key string) (*LockLog, error) {
+	logByte, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(logByte) == 0 {
+		return nil, nil
+	}
+
+	log := new(LockLog)
+	err = json.Unmarshal(logByte, log)
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// getLockLog getLockLog
 func (c *ExchangeChaincode) getLockLogByParm(owner, currency, order string, islock bool) (*LockLog, error) {
 	// var log *LockLog
 	bb, err := c.getCompositeValue("LockLog~owner~curr~order~islock~uuid", []string{owner, currency, order, strconv.FormatBool(islock)}, 4)
 	if err != nil {
 		return nil, err
 	}
+	if len(bb) == 0 {
+		return nil, nil
+	}
 
-	var log *LockLog
+	log := new(LockLog)
 	err = json.Unmarshal(bb[0], log)
 	if err != nil {
 		return nil, err
@@ -465,10 +957,121 @@ type Order struct {
 	RawUUID      string `json:"rawUUID"`
 	Metadata     string `json:"metadata"`
 	FinalCost    int64  `json:"finalCost"`
+	Status       string `json:"status,omitempty"`
+	SrcFilled    int64  `json:"srcFilled,omitempty"`
+	DesFilled    int64  `json:"desFilled,omitempty"`
+	Fee          int64  `json:"fee,omitempty"`
+	FeeCurrency  string `json:"feeCurrency,omitempty"`
+}
+
+// putOrder saves a book order and keeps it in the open order and expiry indexes while it is open
+func (c *ExchangeChaincode) putOrder(order *Order) error {
+	r, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	err = c.putState(order.UUID, r)
+	if err != nil {
+		return err
+	}
+
+	err = c.putCompositeValue("BookOrder~account~uuid", []string{order.Account, order.UUID})
+	if err != nil {
+		return err
+	}
+
+	bookKey, err := c.stub.CreateCompositeKey("BookOrder~src~des~price~time~uuid", []string{order.SrcCurrency, order.DesCurrency, priceKey(order), timeKey(order.PendingTime), order.UUID})
+	if err != nil {
+		return err
+	}
+	keys := []string{bookKey}
+
+	if order.ExpiredTime != 0 {
+		expireKey, err := c.stub.CreateCompositeKey("BookExpire~time~uuid", []string{timeKey(order.ExpiredTime), order.UUID})
+		if err != nil {
+			return err
+		}
+		keys = append(keys, expireKey)
+	}
+
+	for _, key := range keys {
+		if order.isOpen() {
+			err = c.putState(key, NilValue)
+		} else {
+			err = c.delState(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrder getOrder
+func (c *ExchangeChaincode) getOrder(key string) (*Order, error) {
+	orderByte, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(orderByte) == 0 {
+		return nil, nil
+	}
+
+	order := new(Order)
+	err = json.Unmarshal(orderByte, order)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// getExpiredOrders returns up to max open orders that expired before now, by expiry.
+// It reads at most max entries of the expiry index.
+func (c *ExchangeChaincode) getExpiredOrders(now int64, max int) ([]*Order, error) {
+	startKey, err := c.stub.CreateCompositeKey("BookExpire~time~uuid", nil)
+	if err != nil {
+		return nil, err
+	}
+	endKey, err := c.stub.CreateCompositeKey("BookExpire~time~uuid", []string{timeKey(now)})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := c.stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var orders []*Order
+	for read := 0; read < max && resultsIterator.HasNext(); read++ {
+		key, _, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := c.getOrder(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if order != nil && order.isOpen() && order.isExpired(now) {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders, nil
 }
 
 // putTxLog
 func (c *ExchangeChaincode) putTxLog(buyOrder, sellOrder *Order) error {
+	buyOrder.FinishedTime = c.now
+	sellOrder.FinishedTime = c.now
+
 	buyJson, err := json.Marshal(buyOrder)
 	if err != nil {
 		return err
@@ -478,12 +1081,12 @@ func (c *ExchangeChaincode) putTxLog(buyOrder, sellOrder *Order) error {
 		return err
 	}
 
-	err = c.stub.PutState(buyOrder.UUID, buyJson)
+	err = c.putState(buyOrder.UUID, buyJson)
 	if err != nil {
 		return err
 	}
 
-	err = c.stub.PutState(sellOrder.UUID, sellJson)
+	err = c.putState(sellOrder.UUID, sellJson)
 	if err != nil {
 		return err
 	}
@@ -503,17 +1106,66 @@ func (c *ExchangeChaincode) putTxLog(buyOrder, sellOrder *Order) error {
 	if err != nil {
 		return err
 	}
+
+	for _, order := range []*Order{buyOrder, sellOrder} {
+		err = c.putCompositeValue("Order~raw~uuid", []string{order.RawUUID, order.UUID})
+		if err != nil {
+			return err
+		}
+
+		err = c.putCompositeValue("Settled~uuid", []string{order.UUID})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// isSettled reports whether an order UUID has been settled by exchange or match
+func (c *ExchangeChaincode) isSettled(uuid string) (bool, error) {
+	key, err := c.stub.CreateCompositeKey("Settled~uuid", []string{uuid})
+	if err != nil {
+		return false, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return false, err
+	}
+	return len(b) > 0, nil
+}
+
+// getFills returns the settled orders of a raw order
+func (c *ExchangeChaincode) getFills(rawUUID string) ([]*Order, error) {
+	bb, err := c.getCompositeValue("Order~raw~uuid", []string{rawUUID}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*Order
+	for _, v := range bb {
+		order := new(Order)
+		err = json.Unmarshal(v, order)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
 // getTxLog
 func (c *ExchangeChaincode) getTxLog(key string) (*Order, error) {
-	orderByte, err := c.stub.GetState(key)
+	orderByte, err := c.getState(key)
 	if err != nil {
 		return nil, err
 	}
+	if len(orderByte) == 0 {
+		return nil, nil
+	}
 
-	var order *Order
+	order := new(Order)
 	err = json.Unmarshal(orderByte, order)
 	if err != nil {
 		return nil, err
@@ -530,7 +1182,7 @@ func (c *ExchangeChaincode) getTXs(owner, srcCurrency, desCurrency, rawOrder str
 
 	var orders []*Order
 	for _, v := range bb {
-		var order *Order
+		order := new(Order)
 		err = json.Unmarshal(v, order)
 		if err != nil {
 			return nil, err
@@ -541,21 +1193,189 @@ func (c *ExchangeChaincode) getTXs(owner, srcCurrency, desCurrency, rawOrder str
 	return orders, nil
 }
 
-func (c *ExchangeChaincode) getAllTxLog() ([]*Order, error) {
-	bb, err := c.getCompositeValue("Order~uuid", nil, 0)
+// putFeeSchedule putFeeSchedule
+func (c *ExchangeChaincode) putFeeSchedule(schedule *FeeSchedule) error {
+	key, err := c.stub.CreateCompositeKey("FeeSchedule~pair", pairKey(schedule.SrcCurrency, schedule.DesCurrency))
+	if err != nil {
+		return err
+	}
+
+	r, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return c.putState(key, r)
+}
+
+// getFeeSchedule returns the fee schedule of a currency pair in either direction
+func (c *ExchangeChaincode) getFeeSchedule(srcCurrency, desCurrency string) (*FeeSchedule, error) {
+	key, err := c.stub.CreateCompositeKey("FeeSchedule~pair", pairKey(srcCurrency, desCurrency))
 	if err != nil {
 		return nil, err
 	}
 
-	var orders []*Order
-	for _, v := range bb {
-		var order *Order
-		err = json.Unmarshal(v, order)
+	b, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	schedule := new(FeeSchedule)
+	err = json.Unmarshal(b, schedule)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// putFeeCollector putFeeCollector
+func (c *ExchangeChaincode) putFeeCollector(account string) error {
+	return c.putState("FeeCollector", []byte(account))
+}
+
+// getFeeCollector getFeeCollector
+func (c *ExchangeChaincode) getFeeCollector() (string, error) {
+	b, err := c.getState("FeeCollector")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// putFeeTotal putFeeTotal
+func (c *ExchangeChaincode) putFeeTotal(total *FeeTotal) error {
+	key, err := c.stub.CreateCompositeKey("FeeTotal~currency", []string{total.Currency})
+	if err != nil {
+		return err
+	}
+
+	r, err := json.Marshal(total)
+	if err != nil {
+		return err
+	}
+	return c.putState(key, r)
+}
+
+// getFeeTotal getFeeTotal
+func (c *ExchangeChaincode) getFeeTotal(currency string) (*FeeTotal, error) {
+	key, err := c.stub.CreateCompositeKey("FeeTotal~currency", []string{currency})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	total := &FeeTotal{Currency: currency}
+	if len(b) == 0 {
+		return total, nil
+	}
+	err = json.Unmarshal(b, total)
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+// TradeSum is the running total of the settled orders of an account paying
+// SrcCurrency for DesCurrency, the fees are in DesCurrency
+type TradeSum struct {
+	Owner       string `json:"owner"`
+	SrcCurrency string `json:"srcCurrency"`
+	DesCurrency string `json:"desCurrency"`
+	Paid        int64  `json:"paid"`
+	Received    int64  `json:"received"`
+	Fees        int64  `json:"fees"`
+	Count       int64  `json:"count"`
+}
+
+// putTradeSum putTradeSum
+func (c *ExchangeChaincode) putTradeSum(sum *TradeSum) error {
+	key, err := c.stub.CreateCompositeKey("TradeSum~owner~src~des", []string{sum.Owner, sum.SrcCurrency, sum.DesCurrency})
+	if err != nil {
+		return err
+	}
+
+	r, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	return c.putState(key, r)
+}
+
+// getTradeSum returns the running total of a pair of the owner, an empty one when it has none
+func (c *ExchangeChaincode) getTradeSum(owner, src, des string) (*TradeSum, error) {
+	key, err := c.stub.CreateCompositeKey("TradeSum~owner~src~des", []string{owner, src, des})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.getState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &TradeSum{Owner: owner, SrcCurrency: src, DesCurrency: des}
+	if len(b) == 0 {
+		return sum, nil
+	}
+	err = json.Unmarshal(b, sum)
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// getTradeSums returns the running totals of all pairs of the owner
+func (c *ExchangeChaincode) getTradeSums(owner string) ([]*TradeSum, error) {
+	keys, err := c.getCompositeKeys("TradeSum~owner~src~des", []string{owner})
+	if err != nil {
+		return nil, err
+	}
+
+	sums := []*TradeSum{}
+	for _, key := range keys {
+		b, err := c.getState(key)
 		if err != nil {
 			return nil, err
 		}
-		orders = append(orders, order)
+
+		sum := new(TradeSum)
+		err = json.Unmarshal(b, sum)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, sum)
 	}
 
-	return orders, nil
+	return sums, nil
+}
+
+// getAllFeeTotal getAllFeeTotal
+func (c *ExchangeChaincode) getAllFeeTotal() ([]*FeeTotal, error) {
+	keys, err := c.getCompositeKeys("FeeTotal~currency", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := []*FeeTotal{}
+	for _, key := range keys {
+		b, err := c.getState(key)
+		if err != nil {
+			return nil, err
+		}
+
+		total := new(FeeTotal)
+		err = json.Unmarshal(b, total)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+
+	return totals, nil
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// TradeFilter selects the settled orders returned by queryMyTrades.
+// With a pair both directions are returned, From and To bound the FinishedTime.
+type TradeFilter struct {
+	SrcCurrency string `json:"srcCurrency"`
+	DesCurrency string `json:"desCurrency"`
+	From        int64  `json:"from"`
+	To          int64  `json:"to"`
+	RawUUID     string `json:"rawUUID"`
+}
+
+// TradeTotal sums the trades of a currency
+type TradeTotal struct {
+	Currency string `json:"currency"`
+	Paid     int64  `json:"paid"`
+	Received int64  `json:"received"`
+	Fees     int64  `json:"fees"`
+}
+
+// TradeHistory is a page of trades. The first page has the running totals of the
+// account, of the pair when the filter has one, the pages after a bookmark don't.
+// The time range and raw order of the filter don't narrow the totals.
+// AvgPrice is desCurrency per srcCurrency of the pair scaled by pricePrecision.
+type TradeHistory struct {
+	Trades   []*Order      `json:"trades"`
+	Totals   []*TradeTotal `json:"totals,omitempty"`
+	Count    int64         `json:"count,omitempty"`
+	AvgPrice int64         `json:"avgPrice,omitempty"`
+	Bookmark string        `json:"bookmark,omitempty"`
+}
+
+// match reports whether a settled order passes the filter
+func (f *TradeFilter) match(order *Order) bool {
+	if f.RawUUID != "" && order.RawUUID != f.RawUUID {
+		return false
+	}
+	if f.From != 0 && order.FinishedTime < f.From {
+		return false
+	}
+	if f.To != 0 && order.FinishedTime > f.To {
+		return false
+	}
+	return true
+}
+
+// ranges returns the index ranges holding the owner's trades for the filter, in key order
+func (f *TradeFilter) ranges(owner string) []keyRange {
+	index := "Order~owner~src~des~raw~uuid"
+	if f.SrcCurrency == "" {
+		return []keyRange{{index, []string{owner}}}
+	}
+
+	a, b := f.SrcCurrency, f.DesCurrency
+	if a > b {
+		a, b = b, a
+	}
+	ranges := []keyRange{{index, []string{owner, a, b}}, {index, []string{owner, b, a}}}
+	if f.RawUUID != "" {
+		for i := range ranges {
+			ranges[i].attrs = append(ranges[i].attrs, f.RawUUID)
+		}
+	}
+	return ranges
+}
+
+// addTradeSum adds a settled side of an exchange to the running totals of the account
+func (c *ExchangeChaincode) addTradeSum(order *Order) error {
+	sum, err := c.getTradeSum(order.Account, order.SrcCurrency, order.DesCurrency)
+	if err != nil {
+		return err
+	}
+	sum.Paid += order.FinalCost
+	sum.Received += order.DesCount
+	sum.Fees += order.Fee
+	sum.Count++
+	return c.putTradeSum(sum)
+}
+
+// sumTrades sets the totals of a history from the running totals of the owner
+func (c *ExchangeChaincode) sumTrades(history *TradeHistory, owner string, filter *TradeFilter) error {
+	var sums []*TradeSum
+	if filter.SrcCurrency == "" {
+		var err error
+		sums, err = c.getTradeSums(owner)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, pair := range [][2]string{{filter.SrcCurrency, filter.DesCurrency}, {filter.DesCurrency, filter.SrcCurrency}} {
+			sum, err := c.getTradeSum(owner, pair[0], pair[1])
+			if err != nil {
+				return err
+			}
+			sums = append(sums, sum)
+		}
+	}
+
+	totals := map[string]*TradeTotal{}
+	total := func(currency string) *TradeTotal {
+		t, ok := totals[currency]
+		if !ok {
+			t = &TradeTotal{Currency: currency}
+			totals[currency] = t
+		}
+		return t
+	}
+	for _, sum := range sums {
+		if sum.Count == 0 {
+			continue
+		}
+		history.Count += sum.Count
+		total(sum.SrcCurrency).Paid += sum.Paid
+		total(sum.DesCurrency).Received += sum.Received
+		total(sum.DesCurrency).Fees += sum.Fees
+	}
+
+	var currencies []string
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		history.Totals = append(history.Totals, totals[currency])
+	}
+
+	if filter.SrcCurrency != "" {
+		src, des := total(filter.SrcCurrency), total(filter.DesCurrency)
+		base := src.Paid + src.Received
+		if base > 0 {
+			history.AvgPrice = mulDiv(des.Paid+des.Received, pricePrecision, base, false)
+		}
+	}
+	return nil
+}
+
+// queryMyTrades returns the settled orders of an account, both sides
+// args: [owner] (operator only), [json{srcCurrency, desCurrency, from, to, rawUUID}], [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryMyTrades() pb.Response {
+	myLogger.Debug("queryMyTrades...")
+
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	filter := new(TradeFilter)
+	if len(c.args) > 1 && c.args[1] != "" {
+		err = json.Unmarshal([]byte(c.args[1]), filter)
+		if err != nil {
+			return errorResponse(newError(CodeInvalidArgument, "Failed unmarshalling filter: [%s]", err))
+		}
+	}
+	if (filter.SrcCurrency == "") != (filter.DesCurrency == "") || (filter.SrcCurrency != "" && filter.SrcCurrency == filter.DesCurrency) {
+		return errorResponse(newError(CodeInvalidArgument, "The filter needs both currencies of a pair"))
+	}
+
+	pageSize, bookmark, err := c.getPaging(2)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	ranges := filter.ranges(owner)
+	err = c.checkBookmark(ranges, bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	history := &TradeHistory{Trades: []*Order{}, Totals: []*TradeTotal{}}
+	last := ""
+	err = c.scanKeys(ranges, bookmark, func(key string) (bool, error) {
+		_, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return false, err
+		}
+		order, err := c.getTxLog(parts[4])
+		if err != nil {
+			return false, err
+		}
+		if order == nil || !filter.match(order) {
+			return true, nil
+		}
+
+		if len(history.Trades) < pageSize {
+			history.Trades = append(history.Trades, order)
+			last = key
+			return true, nil
+		}
+		history.Bookmark = encodeBookmark(last)
+		return false, nil
+	})
+	if err != nil {
+		myLogger.Errorf("queryMyTrades error1:%s", err)
+		return errorResponse(err)
+	}
+
+	if bookmark == "" {
+		err = c.sumTrades(history, owner, filter)
+		if err != nil {
+			myLogger.Errorf("queryMyTrades error2:%s", err)
+			return errorResponse(err)
+		}
+	}
+
+	payload, err := json.Marshal(history)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryMyTradesTotalsOnTheFirstPage(t *testing.T) {
+	e := newExchangeEnv(t)
+	for i := 1; i <= 3; i++ {
+		checkBatch(t, e.exchange(e.pairJSON(fill{"bob", fmt.Sprintf("B1-%d", i), "B1", 4, 2, 0}, fill{"alice", fmt.Sprintf("A1-%d", i), "A1", 2, 4, 0})), 1)
+	}
+
+	history := new(TradeHistory)
+	mustUnmarshal(t, e.mustInvoke("alice", "queryMyTrades", "", "", "2"), history)
+	if len(history.Trades) != 2 || history.Count != 3 || len(history.Totals) != 2 || history.Bookmark == "" {
+		t.Fatalf("The first page is %+v", history)
+	}
+	for _, total := range history.Totals {
+		if (total.Currency == "BTC" && total.Paid != 6) || (total.Currency == "ETH" && total.Received != 12) {
+			t.Fatalf("The total of %s is %+v", total.Currency, total)
+		}
+	}
+
+	next := new(TradeHistory)
+	mustUnmarshal(t, e.mustInvoke("alice", "queryMyTrades", "", "", "2", history.Bookmark), next)
+	if len(next.Trades) != 1 || next.Count != 0 || len(next.Totals) != 0 || next.Bookmark != "" {
+		t.Fatalf("The second page is %+v", next)
+	}
+	if next.Trades[0].UUID == history.Trades[0].UUID || next.Trades[0].UUID == history.Trades[1].UUID {
+		t.Fatalf("The trade %s is on both pages", next.Trades[0].UUID)
+	}
+}
+
+func TestQueryMyTradesTotalsArePerPair(t *testing.T) {
+	e := newExchangeEnv(t)
+	for i := 1; i <= 3; i++ {
+		checkBatch(t, e.exchange(e.pairJSON(fill{"bob", fmt.Sprintf("B1-%d", i), "B1", 4, 2, 0}, fill{"alice", fmt.Sprintf("A1-%d", i), "A1", 2, 4, 0})), 1)
+	}
+
+	history := new(TradeHistory)
+	mustUnmarshal(t, e.mustInvoke("alice", "queryMyTrades", "", `{"srcCurrency":"ETH","desCurrency":"BTC"}`, "1"), history)
+	if len(history.Trades) != 1 || history.Count != 3 || history.AvgPrice != pricePrecision/2 {
+		t.Fatalf("The first page is %+v", history)
+	}
+
+	// the totals of another pair are empty
+	history = new(TradeHistory)
+	mustUnmarshal(t, e.mustInvoke("alice", "queryMyTrades", "", `{"srcCurrency":"BTC","desCurrency":"CNY"}`), history)
+	if len(history.Trades) != 0 || history.Count != 0 || len(history.Totals) != 0 {
+		t.Fatalf("The CNY trades are %+v", history)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// moveBalance debit the available count of from and credit to, creating its asset if absent
+func (c *ExchangeChaincode) moveBalance(from, to, currency string, count int64) error {
+	if count <= 0 {
+		return newError(CodeInvalidArgument, "The count must be > 0")
+	}
+	if from == to {
+		return newError(CodeInvalidArgument, "Can't transfer to the same account")
+	}
+	err := checkAccountID(to)
+	if err != nil {
+		return err
+	}
+
+	for _, owner := range []string{from, to} {
+		err = c.checkAccountActive(owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	curr, err := c.getCurrencyByName(currency)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", currency, err)
+	}
+	if curr == nil {
+		return newError(CodeCurrencyNotFound, "The currency [%s] does not exist", currency).With("currency", currency)
+	}
+	err = curr.allows("be transferred", (*Currency).canTransfer)
+	if err != nil {
+		return err
+	}
+
+	fromAsset, err := c.getOwnerOneAsset(from, currency)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", currency, err)
+	}
+	if fromAsset == nil {
+		return newError(CodeAssetNotFound, "The user have not currency [%s]", currency).
+			With("owner", from).With("currency", currency)
+	}
+	if fromAsset.Count < count {
+		return newError(CodeInsufficientBalance, "Currency [%s] of the user is insufficient", currency).
+			With("currency", currency).With("required", count).With("available", fromAsset.Count)
+	}
+
+	fromAsset.Count -= count
+	err = c.putAsset(fromAsset)
+	if err != nil {
+		return err
+	}
+
+	toAsset, err := c.getOwnerOneAsset(to, currency)
+	if err != nil {
+		return newError(CodeInternal, "Failed retrieving asset [%s] of the user: [%s]", currency, err)
+	}
+	if toAsset == nil {
+		toAsset = &Asset{Owner: to, Currency: currency}
+	}
+	toAsset.Count += count
+	return c.putAsset(toAsset)
+}
+
+// transfer send available balance of the caller to another account
+// args: currency, recipient, count, [memo]
+func (c *ExchangeChaincode) transfer() pb.Response {
+	myLogger.Debug("Transfer...")
+
+	from, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	currency := c.args[0]
+	to := c.args[1]
+	count, _ := strconv.ParseInt(c.args[2], 10, 64)
+	memo := ""
+	if len(c.args) > 3 {
+		memo = c.args[3]
+	}
+
+	err = c.moveBalance(from, to, currency, count)
+	if err != nil {
+		myLogger.Errorf("transfer error1:%s", err)
+		return errorResponse(err)
+	}
+
+	log := &TransferLog{
+		Currency:     currency,
+		FromUser:     from,
+		ToUser:       to,
+		Count:        count,
+		Memo:         memo,
+		TransferTime: c.now,
+	}
+	err = c.putTransferLog(log)
+	if err != nil {
+		myLogger.Errorf("transfer error2:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(log)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_transfer", payload)
+
+	myLogger.Debug("Transfer...done")
+	return shim.Success(payload)
+}
+
+// queryMyTransferLog pages through the transfers to the owner, then from the owner
+// args: [owner] (operator only), [pageSize], [bookmark]
+func (c *ExchangeChaincode) queryMyTransferLog() pb.Response {
+	myLogger.Debug("queryMyTransferLog...")
+
+	owner, err := c.getAccount(0)
+	if err != nil {
+		return errorResponse(err)
+	}
+	pageSize, bookmark, err := c.getPaging(1)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	keys, next, err := c.getKeysPage([]keyRange{
+		{"TransferLog~to~uuid", []string{owner}},
+		{"TransferLog~from~uuid", []string{owner}},
+	}, pageSize, bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	logs := &struct {
+		ToMe []*TransferLog `json:"toMe"`
+		MeTo []*TransferLog `json:"meTo"`
+	}{}
+	for _, key := range keys {
+		index, parts, err := c.stub.SplitCompositeKey(key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		log, err := c.getTransferLog(parts[1])
+		if err != nil {
+			return errorResponse(err)
+		}
+		if index == "TransferLog~to~uuid" {
+			logs.ToMe = append(logs.ToMe, log)
+		} else {
+			logs.MeTo = append(logs.MeTo, log)
+		}
+	}
+
+	payload, err := json.Marshal(&Page{Records: logs, Bookmark: next})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
+
+// approve allow a spender to transfer up to amount of the caller's currency, 0 revokes it
+// args: spender, currency, amount
+func (c *ExchangeChaincode) approve() pb.Response {
+	myLogger.Debug("Approve...")
+
+	owner, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	spender := c.args[0]
+	currency := c.args[1]
+	amount, _ := strconv.ParseInt(c.args[2], 10, 64)
+	if amount < 0 {
+		return errorResponse(newError(CodeInvalidArgument, "The amount must be >= 0"))
+	}
+	if spender == owner {
+		return errorResponse(newError(CodeInvalidArgument, "Can't approve the same account"))
+	}
+
+	curr, err := c.getCurrencyByName(currency)
+	if err != nil {
+		myLogger.Errorf("approve error1:%s", err)
+		return errorResponse(newError(CodeInternal, "Failed retrieving currency [%s]: [%s]", currency, err))
+	}
+	if curr == nil {
+		return errorResponse(newError(CodeCurrencyNotFound, "The currency [%s] does not exist", currency).With("currency", currency))
+	}
+
+	allowance := &Allowance{Owner: owner, Spender: spender, Currency: currency, Amount: amount}
+	err = c.putAllowance(allowance)
+	if err != nil {
+		myLogger.Errorf("approve error2:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(allowance)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_approve", payload)
+
+	myLogger.Debug("Approve...done")
+	return shim.Success(payload)
+}
+
+// transferFrom spend an allowance, sending the owner's balance to a recipient
+// args: owner, recipient, currency, count, [memo]
+func (c *ExchangeChaincode) transferFrom() pb.Response {
+	myLogger.Debug("Transfer From...")
+
+	spender, err := c.getCaller()
+	if err != nil {
+		return errorResponse(err)
+	}
+	owner := c.args[0]
+	to := c.args[1]
+	currency := c.args[2]
+	count, _ := strconv.ParseInt(c.args[3], 10, 64)
+	memo := ""
+	if len(c.args) > 4 {
+		memo = c.args[4]
+	}
+
+	allowance, err := c.getAllowance(owner, spender, currency)
+	if err != nil {
+		myLogger.Errorf("transferFrom error1:%s", err)
+		return errorResponse(err)
+	}
+	if allowance.Amount < count {
+		return errorResponse(newError(CodeInsufficientAllowance, "The allowance of currency [%s] is insufficient", currency).
+			With("owner", owner).With("spender", spender).With("currency", currency).
+			With("required", count).With("available", allowance.Amount))
+	}
+
+	err = c.moveBalance(owner, to, currency, count)
+	if err != nil {
+		myLogger.Errorf("transferFrom error2:%s", err)
+		return errorResponse(err)
+	}
+
+	allowance.Amount -= count
+	err = c.putAllowance(allowance)
+	if err != nil {
+		myLogger.Errorf("transferFrom error3:%s", err)
+		return errorResponse(err)
+	}
+
+	log := &TransferLog{
+		Currency:     currency,
+		FromUser:     owner,
+		ToUser:       to,
+		Count:        count,
+		Memo:         memo,
+		Spender:      spender,
+		TransferTime: c.now,
+	}
+	err = c.putTransferLog(log)
+	if err != nil {
+		myLogger.Errorf("transferFrom error4:%s", err)
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(log)
+	if err != nil {
+		return errorResponse(err)
+	}
+	c.stub.SetEvent("chaincode_transfer", payload)
+
+	myLogger.Debug("Transfer From...done")
+	return shim.Success(payload)
+}
+
+// queryAllowance
+// args: owner, spender, currency
+func (c *ExchangeChaincode) queryAllowance() pb.Response {
+	myLogger.Debug("queryAllowance...")
+
+	allowance, err := c.getAllowance(c.args[0], c.args[1], c.args[2])
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	payload, err := json.Marshal(allowance)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(payload)
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestTransferMovesTheAvailableBalance(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+	e.placeOrder("alice", "BTC", 60, "ETH", 60)
+
+	log := new(TransferLog)
+	mustUnmarshal(t, e.mustInvoke("alice", "transfer", "BTC", e.acct("bob"), "30", "rent"), log)
+	if log.FromUser != e.acct("alice") || log.ToUser != e.acct("bob") || log.Count != 30 || log.Memo != "rent" || log.TransferTime != e.now {
+		t.Fatalf("The transfer log is %+v", log)
+	}
+	e.checkBalance("alice", "BTC", 10, 60)
+	e.checkBalance("bob", "BTC", 30, 0)
+
+	// the locked balance can't be sent
+	e.mustFail(CodeInsufficientBalance, "alice", "transfer", "BTC", e.acct("bob"), "11")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC", e.acct("bob"), "0")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC", e.acct("alice"), "1")
+	e.mustFail(CodeInvalidArgument, "alice", "transfer", "BTC", "bob", "1")
+	e.mustFail(CodeCurrencyNotFound, "alice", "transfer", "LTC", e.acct("bob"), "1")
+	e.mustFail(CodeAssetNotFound, "carol", "transfer", "BTC", e.acct("bob"), "1")
+
+	var logs struct {
+		ToMe []*TransferLog `json:"toMe"`
+		MeTo []*TransferLog `json:"meTo"`
+	}
+	pageOf(t, e.mustInvoke("bob", "queryMyTransferLog"), &logs)
+	if len(logs.ToMe) != 1 || len(logs.MeTo) != 0 || logs.ToMe[0].Count != 30 {
+		t.Fatalf("bob's transfers are %+v", logs)
+	}
+}
+
+func TestTransferNeedsActiveAccountsAndCurrency(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+
+	e.mustInvoke("admin", "setAccountStatus", e.acct("bob"), AccountFrozen, "test")
+	e.mustFail(CodeAccountUnavailable, "alice", "transfer", "BTC", e.acct("bob"), "1")
+
+	// a paused currency moves, a frozen one doesn't
+	e.mustInvoke("iss", "setCurrencyStatus", "BTC", CurrencyPaused, "test")
+	e.mustInvoke("alice", "transfer", "BTC", e.acct("carol"), "1")
+	e.mustInvoke("admin", "setCurrencyStatus", "BTC", CurrencyFrozen, "test")
+	e.mustFail(CodeCurrencyUnavailable, "alice", "transfer", "BTC", e.acct("carol"), "1")
+	e.checkBalance("alice", "BTC", 99, 0)
+}
+
+func TestTransferFromSpendsTheAllowance(t *testing.T) {
+	e := newTestEnv(t)
+	e.assign("BTC", "alice", 100)
+
+	e.mustFail(CodeInvalidArgument, "alice", "approve", e.acct("alice"), "BTC", "10")
+	e.mustFail(CodeInvalidArgument, "alice", "approve", e.acct("bob"), "BTC", "-1")
+	e.mustInvoke("alice", "approve", e.acct("bob"), "BTC", "50")
+
+	log := new(TransferLog)
+	mustUnmarshal(t, e.mustInvoke("bob", "transferFrom", e.acct("alice"), e.acct("carol"), "BTC", "20"), log)
+	if log.FromUser != e.acct("alice") || log.ToUser != e.acct("carol") || log.Spender != e.acct("bob") {
+		t.Fatalf("The transfer log is %+v", log)
+	}
+	e.checkBalance("alice", "BTC", 80, 0)
+	e.checkBalance("carol", "BTC", 20, 0)
+
+	allowance := new(Allowance)
+	mustUnmarshal(t, e.mustInvoke("carol", "queryAllowance", e.acct("alice"), e.acct("bob"), "BTC"), allowance)
+	if allowance.Amount != 30 {
+		t.Fatalf("The allowance is %d", allowance.Amount)
+	}
+
+	e.mustFail(CodeInsufficientAllowance, "bob", "transferFrom", e.acct("alice"), e.acct("bob"), "BTC", "31")
+	e.mustFail(CodeInvalidArgument, "bob", "transferFrom", e.acct("alice"), "Org1MSP::", "BTC", "1")
+	e.mustFail(CodeInsufficientAllowance, "carol", "transferFrom", e.acct("alice"), e.acct("carol"), "BTC", "1")
+
+	// approving 0 revokes the allowance
+	e.mustInvoke("alice", "approve", e.acct("bob"), "BTC", "0")
+	e.mustFail(CodeInsufficientAllowance, "bob", "transferFrom", e.acct("alice"), e.acct("bob"), "BTC", "1")
+	e.checkBalance("alice", "BTC", 80, 0)
+}
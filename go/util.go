@@ -1,10 +1,9 @@
 package main
 
 import (
-	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"io"
 )
 
 func dealParam(function string, args []string) (string, []string) {
@@ -23,26 +22,19 @@ func dealParam(function string, args []string) (string, []string) {
 	return string(functionB), args
 }
 
-// GenerateBytesUUID returns a UUID based on RFC 4122 returning the generated bytes
-func GenerateBytesUUID() []byte {
-	uuid := make([]byte, 16)
-	_, err := io.ReadFull(rand.Reader, uuid)
-	if err != nil {
-		panic(fmt.Sprintf("Error generating UUID: %s", err))
-	}
+// newUUID returns a record ID derived from the transaction ID and a sequence
+// number local to the transaction, so that every endorser writes the same keys
+func (c *ExchangeChaincode) newUUID() string {
+	c.seq++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", c.stub.GetTxID(), c.seq)))
+	uuid := sum[:16]
 
 	// variant bits; see section 4.1.1
 	uuid[8] = uuid[8]&^0xc0 | 0x80
 
-	// version 4 (pseudo-random); see section 4.1.3
-	uuid[6] = uuid[6]&^0xf0 | 0x40
-
-	return uuid
-}
+	// version 5 (name-based); see section 4.1.3
+	uuid[6] = uuid[6]&^0xf0 | 0x50
 
-// GenerateUUID returns a UUID based on RFC 4122
-func GenerateUUID() string {
-	uuid := GenerateBytesUUID()
 	return idBytesToStr(uuid)
 }
 
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// uuids returns n record IDs generated in the transaction
+func uuids(txID string, n int) []string {
+	stub := shim.NewMockStub("exchange", nil)
+	stub.MockTransactionStart(txID)
+	c := &ExchangeChaincode{stub: stub}
+
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, c.newUUID())
+	}
+	return ids
+}
+
+func TestNewUUIDIsDerivedFromTheTransaction(t *testing.T) {
+	a, b := uuids("tx1", 3), uuids("tx1", 3)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("The endorsers disagree on ID %d: %s and %s", i, a[i], b[i])
+		}
+	}
+	if a[0] == a[1] || a[1] == a[2] {
+		t.Fatalf("The IDs of a transaction repeat: %v", a)
+	}
+	if other := uuids("tx2", 1); other[0] == a[0] {
+		t.Fatalf("The transactions share the ID %s", a[0])
+	}
+
+	// a version 5 UUID with the RFC 4122 variant
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, id := range a {
+		if !format.MatchString(id) {
+			t.Fatalf("The ID %s is not a version 5 UUID", id)
+		}
+	}
+}
+
+func TestEndorsersWriteTheSameRecords(t *testing.T) {
+	a, b := newTestEnv(t), newTestEnv(t)
+	for _, e := range []*testEnv{a, b} {
+		e.assign("BTC", "alice", 10)
+	}
+
+	orderA := a.placeOrder("alice", "BTC", 10, "ETH", 20)
+	orderB := b.placeOrder("alice", "BTC", 10, "ETH", 20)
+	if orderA != orderB {
+		t.Fatalf("The same transaction placed the orders %s and %s", orderA, orderB)
+	}
+	if a.asset("alice", "BTC").UUID != b.asset("alice", "BTC").UUID {
+		t.Fatal("The same transactions created different asset records")
+	}
+}